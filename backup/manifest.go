@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DefaultLayout is the folder layout used when the config doesn't have one
+const DefaultLayout = "{year}/{month}"
+
+// ManifestFilename is the name of the manifest in the backup dir, which starts
+// with files.PhotosyncFilePrefix so scans leave it out
+const ManifestFilename = ".photosync-backup.json"
+
+// Entry is a backed up media item
+type Entry struct {
+	MediaItemID  string `json:"mediaItemId"`
+	Filename     string `json:"filename"`
+	CreationTime string `json:"creationTime"`
+	// Path is relative to the backup dir, using forward slashes
+	Path string `json:"path"`
+	// Hash is the hex SHA-256 hash of the downloaded file
+	Hash       string `json:"hash"`
+	BackedUpAt string `json:"backedUpAt"`
+	// RemovedAt is when the media item was first found to be gone from the
+	// library, empty while it is still there. The file is kept either way.
+	RemovedAt string `json:"removedAt,omitempty"`
+}
+
+// Manifest maps the media items in a backup to their local files
+type Manifest struct {
+	path    string
+	entries map[string]*Entry
+}
+
+// LoadManifest reads the manifest in the backup dir, which is empty if there
+// isn't one yet
+func LoadManifest(backupDir string) (*Manifest, error) {
+	m := &Manifest{
+		path:    filepath.Join(backupDir, ManifestFilename),
+		entries: map[string]*Entry{},
+	}
+	manifestJSON, err := ioutil.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := []*Entry{}
+	if err := json.Unmarshal(manifestJSON, &entries); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		m.entries[entry.MediaItemID] = entry
+	}
+	return m, nil
+}
+
+// Get gets the entry for a media item, or nil if it isn't backed up
+func (m *Manifest) Get(mediaItemID string) *Entry {
+	return m.entries[mediaItemID]
+}
+
+// Put adds or replaces the entry for a media item
+func (m *Manifest) Put(entry *Entry) {
+	m.entries[entry.MediaItemID] = entry
+}
+
+// Entries gets all the entries, sorted by path
+func (m *Manifest) Entries() []*Entry {
+	entries := []*Entry{}
+	for _, entry := range m.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// Save writes the manifest, going through a temporary file so an interrupted
+// save doesn't lose the old manifest
+func (m *Manifest) Save() error {
+	manifestJSON, err := json.MarshalIndent(m.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := m.path + ".tmp"
+	if err := ioutil.WriteFile(tempPath, manifestJSON, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, m.path)
+}
@@ -0,0 +1,258 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jastribl/photosync/download"
+	"github.com/jastribl/photosync/export"
+	"github.com/jastribl/photosync/files"
+	"github.com/jastribl/photosync/labelling"
+	"github.com/jastribl/photosync/photos"
+)
+
+func newAlbumCreateCommand() *Command {
+	cmd := newCommand("album create", "<album title>", "Create a new album", 1, 1)
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+
+		title := args[0]
+		ctx.Out.Info("Creating new album: '" + title + "'")
+
+		album, err := client.CreateAlbum(title)
+		if err != nil {
+			return err
+		}
+		if album == nil || album.ID == "" {
+			return errors.New("error creating album")
+		}
+		ctx.Out.Result(
+			"album",
+			Fields{"id": album.ID, "title": album.Title, "url": album.ProductULR},
+			"Created album '%s': %s",
+			album.Title,
+			album.ProductULR,
+		)
+		return nil
+	}
+	return cmd
+}
+
+func newAlbumExportCommand() *Command {
+	cmd := newCommand(
+		"album export",
+		"<export dir> [album title]",
+		"Download an album, or every album with --all, into a folder per album in album order",
+		1, 2,
+	)
+	allAlbums := cmd.Flags.Bool("all", false, "export every album instead of a single one")
+	labelsFrom := cmd.Flags.String(
+		"labels-from",
+		"",
+		"root picture dir to work out the album's labels from, the same way the label command does, instead of the labels the label command added",
+	)
+	sidecar := cmd.Flags.String(
+		"sidecar",
+		"md",
+		"how to write the album's order and labels next to its files: md or json (album.json is always written, to find files exported before)",
+	)
+	prune := cmd.Flags.Bool("prune", false, "delete files of media items no longer in the album instead of only reporting them")
+	workers := cmd.Flags.Int("workers", 0, "how many media items to download at once (default from the config's download-workers)")
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		exportDir := args[0]
+		if *allAlbums == (len(args) == 2) {
+			return errors.New("Pass either an album title or --all")
+		}
+		if *sidecar != "md" && *sidecar != "json" {
+			return fmt.Errorf("Unknown sidecar '%s', must be md or json", *sidecar)
+		}
+		if *workers == 0 {
+			*workers = ctx.Config().DownloadWorkers
+		}
+
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+		var albums []*photos.Album
+		if *allAlbums {
+			albums, err = client.GetAllAlbumsWithCache()
+			if err != nil {
+				return err
+			}
+		} else {
+			album, err := client.GetAlbumWithTitle(args[1])
+			if err != nil {
+				return err
+			}
+			if album == nil {
+				return errors.New("Album not found with name '" + args[1] + "'")
+			}
+			albums = []*photos.Album{album}
+		}
+
+		var localFiles []*files.LocalFile
+		labelDepth, labelTemplate, subLabelTemplate := labelSettings(ctx.Config(), 0, "", "")
+		if *labelsFrom != "" {
+			localFiles, err = ctx.ScanLocalFiles(*labelsFrom)
+			if err != nil {
+				return err
+			}
+		}
+
+		labelRecord, err := labelling.OpenRecord(filepath.Join(ctx.Config().CacheDir, createdLabelsRecordFilename))
+		if err != nil {
+			return err
+		}
+
+		albumsPerName := map[string]int{}
+		for _, album := range albums {
+			albumsPerName[export.SafeName(album.Title)] += 1
+		}
+		jobs := []*download.Job{}
+		for _, album := range albums {
+			mediaItems, err := client.GetAllMediaItemsForAlbumWithCache(album)
+			if err != nil {
+				return err
+			}
+			labels := labelRecord.Labels(album.ID, mediaItems)
+			if *labelsFrom != "" {
+				listOfFolderInfo, err := labelling.GetFolderInfo(
+					*labelsFrom,
+					client,
+					album,
+					localFiles,
+					ctx.FilenameEquivalence(),
+					labelDepth,
+				)
+				if err != nil {
+					return err
+				}
+				labels = labelling.GetLabels(listOfFolderInfo, labelTemplate, subLabelTemplate)
+			}
+
+			// albums can share a title, so give each its own folder
+			folderName, err := export.FolderName(exportDir, album, albumsPerName[export.SafeName(album.Title)] > 1)
+			if err != nil {
+				return err
+			}
+			albumDir := filepath.Join(exportDir, folderName)
+			if err := os.MkdirAll(albumDir, 0777); err != nil {
+				return err
+			}
+
+			exported := export.NewAlbum(album, mediaItems, labels)
+			previous, err := export.LoadAlbum(albumDir)
+			if err != nil {
+				return err
+			}
+			moved, err := exported.MoveFiles(albumDir, previous)
+			if err != nil {
+				return err
+			}
+			for _, move := range moved.Moved {
+				ctx.Out.Result(
+					"export-moved",
+					Fields{"title": album.Title, "mediaItemId": move.MediaItemID, "from": move.From, "to": move.To},
+					"Moved '%s' to '%s' in '%s'",
+					move.From,
+					move.To,
+					album.Title,
+				)
+			}
+			for _, move := range moved.Conflicts {
+				ctx.Out.Result(
+					"export-conflict",
+					Fields{"title": album.Title, "mediaItemId": move.MediaItemID, "from": move.From, "to": move.To},
+					"Left '%s' in '%s' where it is, '%s' is already taken by another file",
+					move.From,
+					album.Title,
+					move.To,
+				)
+			}
+			for _, path := range moved.Stale {
+				message := "'%s' in '%s' is no longer in the album, pass --prune to delete it"
+				if *prune {
+					if err := os.Remove(filepath.Join(albumDir, path)); err != nil {
+						return err
+					}
+					message = "Deleted '%s' in '%s', it is no longer in the album"
+				}
+				ctx.Out.Result(
+					"export-stale",
+					Fields{"title": album.Title, "path": path, "deleted": *prune},
+					message,
+					path,
+					album.Title,
+				)
+			}
+
+			sidecarPath, err := exported.WriteJSON(albumDir)
+			if err != nil {
+				return err
+			}
+			if *sidecar == "md" {
+				sidecarPath, err = exported.WriteMarkdown(albumDir)
+				if err != nil {
+					return err
+				}
+			}
+			ctx.Out.Result(
+				"album-exported",
+				Fields{"title": album.Title, "dir": albumDir, "sidecar": sidecarPath, "numMediaItems": len(mediaItems), "numLabels": len(labels)},
+				"Exporting '%s' (%d media items, %d labels) to %s",
+				album.Title,
+				len(mediaItems),
+				len(labels),
+				albumDir,
+			)
+
+			for _, item := range exported.Items {
+				if item.Type != export.ItemMediaItem {
+					continue
+				}
+				path := filepath.Join(albumDir, item.Path)
+				if files.FileExists(path) {
+					continue
+				}
+				jobs = append(jobs, &download.Job{MediaItem: item.MediaItem(), Path: path})
+			}
+		}
+
+		log.Printf("Downloading %d media items\n", len(jobs))
+		numDownloaded := 0
+		numFailed := 0
+		err = download.Run(ctx, client, jobs, *workers, func(result *download.Result) {
+			if result.Err != nil {
+				ctx.Out.Result(
+					"download-failed",
+					Fields{"filename": result.MediaItem.Filename, "url": result.MediaItem.ProductULR, "error": result.Err.Error()},
+					"Failed to download: (%s) %s",
+					result.MediaItem.Filename,
+					result.Err.Error(),
+				)
+				numFailed += 1
+				return
+			}
+			ctx.Out.Result(
+				"downloaded",
+				Fields{"filename": result.MediaItem.Filename, "path": result.Path, "resumed": result.Resumed},
+				"Downloaded: %s",
+				result.Path,
+			)
+			numDownloaded += 1
+		})
+		log.Printf("Num Downloaded: %d\n", numDownloaded)
+		log.Printf("Num Failed: %d\n", numFailed)
+		return err
+	}
+	return cmd
+}
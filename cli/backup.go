@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jastribl/photosync/backup"
+	"github.com/jastribl/photosync/download"
+	"github.com/jastribl/photosync/photos"
+)
+
+// backupSaveInterval is how many downloads happen between manifest saves, so
+// not much is lost when a backup is interrupted
+const backupSaveInterval = 100
+
+func newBackupCommand() *Command {
+	cmd := newCommand(
+		"backup",
+		"[backup dir]",
+		"Mirror the whole library into a local dir, only downloading media items that aren't backed up yet",
+		0, 1,
+	)
+	fullSync := cmd.Flags.Bool("full", false, "re-fetch every media item first, which is needed to find media items removed from the library")
+	layout := cmd.Flags.String(
+		"layout",
+		"",
+		"folder under the backup dir for each media item, with {year}, {month} and {day} from the creation date (default from the config's backup-layout)",
+	)
+	workers := cmd.Flags.Int("workers", 0, "how many media items to download at once (default from the config's download-workers)")
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		cfg := ctx.Config()
+		backupDir := cfg.BackupDir
+		if len(args) > 0 {
+			backupDir = args[0]
+		}
+		if backupDir == "" {
+			return errors.New("No backup dir, pass one or set backup-dir in the config")
+		}
+		if *layout == "" {
+			*layout = cfg.BackupLayout
+		}
+		if *layout == "" {
+			*layout = backup.DefaultLayout
+		}
+		if *workers == 0 {
+			*workers = cfg.DownloadWorkers
+		}
+		ctx.Out.Info("Backing up to: '" + backupDir + "'")
+
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+		var mediaItems []*photos.MediaItem
+		if *fullSync {
+			mediaItems, err = client.CacheAndReturnAllMediaItems()
+		} else {
+			mediaItems, err = client.RefreshMediaItemsCache(
+				time.Duration(cfg.FullCacheSyncDays) * 24 * time.Hour,
+			)
+		}
+		if err != nil {
+			return err
+		}
+		// go through the media items in a fixed order so that paths are given
+		// out the same way every time
+		sort.SliceStable(mediaItems, func(i, j int) bool {
+			if mediaItems[i].MediaMetadata.CreationTime != mediaItems[j].MediaMetadata.CreationTime {
+				return mediaItems[i].MediaMetadata.CreationTime < mediaItems[j].MediaMetadata.CreationTime
+			}
+			return mediaItems[i].ID < mediaItems[j].ID
+		})
+
+		if err := os.MkdirAll(backupDir, 0777); err != nil {
+			return err
+		}
+		manifest, err := backup.LoadManifest(backupDir)
+		if err != nil {
+			return err
+		}
+
+		// Flag the backed up media items that are gone from the library
+		inLibrary := map[string]bool{}
+		for _, mediaItem := range mediaItems {
+			inLibrary[mediaItem.ID] = true
+		}
+		now := time.Now().Format(time.RFC3339)
+		numRemoved := 0
+		planner := download.NewIDSuffixPlanner()
+		for _, entry := range manifest.Entries() {
+			planner.Reserve(filepath.Join(backupDir, filepath.FromSlash(entry.Path)))
+			if inLibrary[entry.MediaItemID] {
+				entry.RemovedAt = ""
+				continue
+			}
+			if entry.RemovedAt == "" {
+				entry.RemovedAt = now
+			}
+			ctx.Out.Result(
+				"backup-removed",
+				Fields{"mediaItemId": entry.MediaItemID, "path": entry.Path, "removedAt": entry.RemovedAt},
+				"Removed from the library since %s: %s",
+				entry.RemovedAt,
+				entry.Path,
+			)
+			numRemoved += 1
+		}
+
+		jobs := []*download.Job{}
+		for _, mediaItem := range mediaItems {
+			if entry := manifest.Get(mediaItem.ID); entry != nil {
+				path := filepath.Join(backupDir, filepath.FromSlash(entry.Path))
+				if _, err := os.Stat(path); err == nil {
+					continue
+				}
+				// the file was deleted, so download it again to the same place
+				jobs = append(jobs, &download.Job{MediaItem: mediaItem, Path: path})
+				continue
+			}
+			folder, err := download.ExpandLayout(*layout, mediaItem)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, planner.Plan(mediaItem, filepath.Join(backupDir, folder)))
+		}
+
+		log.Printf("Backing up %d media items\n", len(jobs))
+		numBackedUp := 0
+		numFailed := 0
+		var saveErr error
+		err = download.Run(ctx, client, jobs, *workers, func(result *download.Result) {
+			if result.Err != nil {
+				ctx.Out.Result(
+					"backup-failed",
+					Fields{"filename": result.MediaItem.Filename, "url": result.MediaItem.ProductULR, "error": result.Err.Error()},
+					"Failed to back up: (%s) %s",
+					result.MediaItem.Filename,
+					result.Err.Error(),
+				)
+				numFailed += 1
+				return
+			}
+			relPath, err := filepath.Rel(backupDir, result.Path)
+			if err != nil {
+				relPath = result.Path
+			}
+			manifest.Put(&backup.Entry{
+				MediaItemID:  result.MediaItem.ID,
+				Filename:     result.MediaItem.Filename,
+				CreationTime: result.MediaItem.MediaMetadata.CreationTime,
+				Path:         filepath.ToSlash(relPath),
+				Hash:         result.Hash,
+				BackedUpAt:   time.Now().Format(time.RFC3339),
+			})
+			if err := client.PutMediaItemHash(result.MediaItem.ID, result.Hash); err != nil {
+				log.Printf("Unable to cache the hash of '%s': %s\n", result.MediaItem.Filename, err.Error())
+			}
+			ctx.Out.Result(
+				"backed-up",
+				Fields{"mediaItemId": result.MediaItem.ID, "path": filepath.ToSlash(relPath), "hash": result.Hash},
+				"Backed up: %s",
+				filepath.ToSlash(relPath),
+			)
+			numBackedUp += 1
+			if numBackedUp%backupSaveInterval == 0 && saveErr == nil {
+				saveErr = manifest.Save()
+			}
+		})
+		// save whatever got backed up, even when interrupted
+		if err := manifest.Save(); err != nil {
+			return err
+		}
+		log.Printf("Num Backed Up: %d\n", numBackedUp)
+		log.Printf("Num Failed: %d\n", numFailed)
+		log.Printf("Num Removed From Library: %d\n", numRemoved)
+		if err != nil {
+			return err
+		}
+		return saveErr
+	}
+	return cmd
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"log"
+	"time"
+)
+
+func newCacheCommand() *Command {
+	cmd := newCommand(
+		"cache",
+		"",
+		"Bring the cache of all media items (and optionally albums) up to date",
+		0, 0,
+	)
+	fullSync := cmd.Flags.Bool("full", false, "re-fetch every media item instead of only new ones")
+	refreshAlbums := cmd.Flags.Bool("albums", false, "also re-fetch all albums and the media items in each of them")
+	hashAll := cmd.Flags.Bool("hashes", false, "also download and hash every photo that hasn't been hashed yet, for the hash match strategy")
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+
+		allMediaItems, err := client.GetAllMediaItemsWithCache()
+		if err != nil {
+			return err
+		}
+		oldCacheSize := len(allMediaItems)
+		ctx.Out.Info("Old Cache Size: %d", oldCacheSize)
+
+		if *fullSync {
+			allMediaItems, err = client.CacheAndReturnAllMediaItems()
+		} else {
+			allMediaItems, err = client.RefreshMediaItemsCache(
+				time.Duration(ctx.Config().FullCacheSyncDays) * 24 * time.Hour,
+			)
+		}
+		if err != nil {
+			return err
+		}
+
+		ctx.Out.Result(
+			"cache",
+			Fields{"oldCacheSize": oldCacheSize, "newCacheSize": len(allMediaItems)},
+			"Old Cache Size: %d\nNew Cache Size: %d",
+			oldCacheSize,
+			len(allMediaItems),
+		)
+
+		if *refreshAlbums {
+			albums, err := client.RefreshAlbumsCache(true)
+			if err != nil {
+				return err
+			}
+			ctx.Out.Result("albums", Fields{"numAlbums": len(albums)}, "Cached Albums: %d", len(albums))
+		}
+
+		if *hashAll {
+			numHashed := 0
+			for _, mediaItem := range allMediaItems {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if mediaItem.MediaMetadata.Video != nil {
+					// downloaded videos are processed, so never hash the same
+					// as a local file
+					continue
+				}
+				_, err := client.GetMediaItemHashWithCache(mediaItem)
+				if err != nil {
+					log.Printf("Unable to hash '%s': %s\n", mediaItem.Filename, err.Error())
+					continue
+				}
+				numHashed += 1
+			}
+			ctx.Out.Result("hashes", Fields{"numHashed": numHashed}, "Hashed Media Items: %d", numHashed)
+		}
+		return nil
+	}
+	return cmd
+}
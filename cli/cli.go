@@ -0,0 +1,397 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/jastribl/photosync/config"
+	"github.com/jastribl/photosync/files"
+	"github.com/jastribl/photosync/match"
+	"github.com/jastribl/photosync/photos"
+	"github.com/jastribl/photosync/rules"
+)
+
+// Command is a single photosync subcommand
+type Command struct {
+	// Name is the full name of the command, which can be more than one word,
+	// e.g. "album create"
+	Name string
+	// ArgsUsage describes the positional args, e.g. "<album title>"
+	ArgsUsage string
+	Summary   string
+	Flags     *flag.FlagSet
+	// MinArgs and MaxArgs bound the number of positional args, -1 for no max
+	MinArgs int
+	MaxArgs int
+	Run     func(ctx *Context, args []string) error
+}
+
+func newCommand(name, argsUsage, summary string, minArgs, maxArgs int) *Command {
+	return &Command{
+		Name:      name,
+		ArgsUsage: argsUsage,
+		Summary:   summary,
+		Flags:     flag.NewFlagSet(name, flag.ContinueOnError),
+		MinArgs:   minArgs,
+		MaxArgs:   maxArgs,
+	}
+}
+
+// globalFlags are the flags that every command takes
+type globalFlags struct {
+	configPath string
+	profile    string
+	output     string
+}
+
+func (g *globalFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.configPath, "config", g.configPath, "path to the config file")
+	fs.StringVar(&g.profile, "profile", g.profile, "config profile to use (default $"+config.ProfileEnvVar+")")
+	fs.StringVar(&g.output, "output", g.output, "output format, one of: text, json")
+}
+
+// Context holds everything a command needs to run. It is also a
+// context.Context that gets cancelled on an interrupt.
+type Context struct {
+	context.Context
+	Out     *Output
+	command *Command
+	profile string
+	cfg     *config.Config
+	client  *photos.Client
+}
+
+// Config gets the config for the selected profile
+func (c *Context) Config() *config.Config {
+	if c.cfg == nil {
+		c.cfg = config.NewConfigForProfile(c.profile)
+	}
+	return c.cfg
+}
+
+// Client gets a Photos client for the selected profile, authenticating if
+// needed
+func (c *Context) Client() (*photos.Client, error) {
+	if c.client == nil {
+		client, err := photos.NewClientForUser(c, c.Config())
+		if err != nil {
+			return nil, err
+		}
+		c.client = client
+	}
+	return c.client, nil
+}
+
+// FolderRules gets the folder rules the config has for the command
+func (c *Context) FolderRules() (*rules.FolderRules, error) {
+	return rules.ForCommand(c.Config(), c.command.Name)
+}
+
+// ScanLocalFiles scans a local dir with the command's folder rules, reporting
+// any files or dirs that couldn't be read
+func (c *Context) ScanLocalFiles(rootDir string) ([]*files.LocalFile, error) {
+	folderRules, err := c.FolderRules()
+	if err != nil {
+		return nil, err
+	}
+	return c.scanLocalFilesWithConfig(rootDir, c.Config(), folderRules)
+}
+
+func (c *Context) scanLocalFilesWithConfig(
+	rootDir string,
+	cfg *config.Config,
+	folderRules *rules.FolderRules,
+) ([]*files.LocalFile, error) {
+	result, err := files.ScanDir(c, rootDir, &files.ScanOptions{
+		FolderRules:    folderRules,
+		FollowSymlinks: cfg.FollowSymlinks,
+		Workers:        cfg.ScanWorkers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, scanError := range result.Errors {
+		c.Out.Result(
+			"scan-error",
+			Fields{"path": scanError.Path, "error": scanError.Err.Error()},
+			"Unable to read: %s",
+			scanError.Error(),
+		)
+	}
+	return result.Files, nil
+}
+
+// FilenameEquivalence gets the config's filename equivalence, falling back to
+// the default extension groups and suffixes
+func (c *Context) FilenameEquivalence() *files.FilenameEquivalence {
+	return filenameEquivalenceForConfig(c.Config())
+}
+
+func filenameEquivalenceForConfig(cfg *config.Config) *files.FilenameEquivalence {
+	extensionGroups := cfg.ExtensionGroups
+	if extensionGroups == nil {
+		extensionGroups = files.DefaultExtensionGroups
+	}
+	suffixes := cfg.FilenameSuffixes
+	if suffixes == nil {
+		suffixes = files.DefaultFilenameSuffixes
+	}
+	return files.NewFilenameEquivalence(extensionGroups, suffixes)
+}
+
+// addMatchFlag adds the --match flag for picking the match strategy
+func addMatchFlag(cmd *Command) *string {
+	return cmd.Flags.String(
+		"match",
+		"",
+		"how to match local files with media items, one of: filename, filename+date, hash, score (default from the config's match-strategy, or filename)",
+	)
+}
+
+// Matcher gets a matcher with the given match strategy, or the one from the
+// config if it is empty
+func (c *Context) Matcher(client *photos.Client, strategyName string) (*match.Matcher, error) {
+	return matcherForConfig(client, strategyName, c.Config())
+}
+
+func matcherForConfig(client *photos.Client, strategyName string, cfg *config.Config) (*match.Matcher, error) {
+	if strategyName == "" {
+		strategyName = cfg.MatchStrategy
+	}
+	strategy, err := match.ParseStrategy(strategyName)
+	if err != nil {
+		return nil, err
+	}
+	return match.NewMatcher(client, strategy, cfg.MatchMinScore, filenameEquivalenceForConfig(cfg)), nil
+}
+
+// reportAmbiguous reports the candidates of a local file that matches several
+// media items too closely to pick one of them
+func reportAmbiguous(ctx *Context, ambiguity *match.Ambiguity) {
+	for i, candidate := range ambiguity.Candidates {
+		ctx.Out.Result(
+			"ambiguous",
+			Fields{
+				"path":     ambiguity.LocalFile.Path,
+				"filename": candidate.MediaItem.Filename,
+				"url":      candidate.MediaItem.ProductULR,
+				"score":    candidate.Total,
+				"reasons":  candidate.Reasons,
+			},
+			"Ambiguous match for %s (%d): %s (score %d: %s) - %s",
+			ambiguity.LocalFile.Path,
+			i,
+			candidate.MediaItem.Filename,
+			candidate.Total,
+			strings.Join(candidate.Reasons, ", "),
+			candidate.MediaItem.ProductULR,
+		)
+	}
+}
+
+// allCommands returns every command, sorted by name
+func allCommands() []*Command {
+	commands := []*Command{
+		newAlbumCreateCommand(),
+		newAlbumExportCommand(),
+		newBackupCommand(),
+		newCacheCommand(),
+		newCompareAccountsCommand(),
+		newCompletionCommand(),
+		newDiffCommand(),
+		newExplainCommand(),
+		newLabelCommand(),
+		newMirrorAlbumsCommand(),
+		newMissingLocalCommand(),
+		newMissingPhotosCommand(),
+		newSortCommand(),
+		newSpaceSaverCommand(),
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	return commands
+}
+
+// findCommand finds the command named by the first words of args, returning
+// it along with the rest of the args
+func findCommand(commands []*Command, args []string) (*Command, []string) {
+	var found *Command
+	numWords := 0
+	for _, command := range commands {
+		words := strings.Fields(command.Name)
+		if len(words) > len(args) || len(words) <= numWords {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == command.Name {
+			found = command
+			numWords = len(words)
+		}
+	}
+	return found, args[numWords:]
+}
+
+// parseInterspersed parses flags that come before, after or in between the
+// positional args, returning the positional args. Everything after a "--" is
+// a positional arg, even if it starts with "-".
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positionalArgs := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		remaining := fs.Args()
+		// Parse stops after a "--" without returning it, unless the "--" was
+		// a flag's value
+		parsed := len(args) - len(remaining)
+		if parsed > 0 && args[parsed-1] == "--" && (parsed == 1 || !takesValue(fs, args[parsed-2])) {
+			return append(positionalArgs, remaining...), nil
+		}
+		if len(remaining) == 0 {
+			return positionalArgs, nil
+		}
+		positionalArgs = append(positionalArgs, remaining[0])
+		args = remaining[1:]
+	}
+}
+
+// takesValue returns if the arg is a flag whose value is the next arg
+func takesValue(fs *flag.FlagSet, arg string) bool {
+	if !strings.HasPrefix(arg, "-") || arg == "--" || strings.Contains(arg, "=") {
+		return false
+	}
+	f := fs.Lookup(strings.TrimLeft(arg, "-"))
+	if f == nil {
+		return false
+	}
+	boolFlag, isBool := f.Value.(interface{ IsBoolFlag() bool })
+	return !isBool || !boolFlag.IsBoolFlag()
+}
+
+func printUsage(w io.Writer, commands []*Command) {
+	fmt.Fprintln(w, "Usage: photosync [global flags] <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %-18s %s\n", command.Name, command.Summary)
+	}
+	fmt.Fprintf(w, "  %-18s %s\n", "help", "Show help for a command")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	globalFlagSet := flag.NewFlagSet("photosync", flag.ContinueOnError)
+	globalFlagSet.SetOutput(w)
+	(&globalFlags{output: "text"}).register(globalFlagSet)
+	globalFlagSet.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'photosync help <command>' for more about a command.")
+}
+
+func printCommandUsage(w io.Writer, command *Command) {
+	fmt.Fprintf(w, "Usage: photosync %s [flags] %s\n\n", command.Name, command.ArgsUsage)
+	fmt.Fprintln(w, command.Summary)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	command.Flags.SetOutput(w)
+	command.Flags.PrintDefaults()
+}
+
+// Run runs photosync with the given args (not including the program name) and
+// returns the exit code
+func Run(args []string) int {
+	// Setup logging
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	commands := allCommands()
+	if len(args) > 0 && args[0] == "__complete" {
+		for _, word := range completeWords(commands, args[1:]) {
+			fmt.Println(word)
+		}
+		return 0
+	}
+
+	globals := &globalFlags{output: "text"}
+	globalFlagSet := flag.NewFlagSet("photosync", flag.ContinueOnError)
+	globalFlagSet.Usage = func() { printUsage(os.Stderr, commands) }
+	globals.register(globalFlagSet)
+	if err := globalFlagSet.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	args = globalFlagSet.Args()
+
+	if len(args) == 0 {
+		printUsage(os.Stderr, commands)
+		return 2
+	}
+	if args[0] == "help" {
+		if command, _ := findCommand(commands, args[1:]); command != nil {
+			printCommandUsage(os.Stdout, command)
+		} else {
+			printUsage(os.Stdout, commands)
+		}
+		return 0
+	}
+
+	command, args := findCommand(commands, args)
+	if command == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", strings.Join(args, " "))
+		printUsage(os.Stderr, commands)
+		return 2
+	}
+	globals.register(command.Flags)
+	command.Flags.Usage = func() { printCommandUsage(os.Stderr, command) }
+	args, err := parseInterspersed(command.Flags, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if len(args) < command.MinArgs || (command.MaxArgs >= 0 && len(args) > command.MaxArgs) {
+		fmt.Fprintf(os.Stderr, "Wrong number of args for '%s'\n\n", command.Name)
+		printCommandUsage(os.Stderr, command)
+		return 2
+	}
+
+	out, err := newOutput(globals.output, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	if out.IsJSON() {
+		// keep stdout for the JSON output only
+		log.SetOutput(os.Stderr)
+	}
+	if globals.configPath != "" {
+		config.SetConfigFileLocation(globals.configPath)
+	}
+	profile := globals.profile
+	if profile == "" {
+		profile = os.Getenv(config.ProfileEnvVar)
+	}
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx := &Context{
+		Context: signalCtx,
+		Out:     out,
+		command: command,
+		profile: profile,
+	}
+	if err := command.Run(ctx, args); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
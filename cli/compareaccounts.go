@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/jastribl/photosync/config"
+	"github.com/jastribl/photosync/files"
+	"github.com/jastribl/photosync/photos"
+	"github.com/jastribl/photosync/rules"
+)
+
+func newCompareAccountsCommand() *Command {
+	cmd := newCommand(
+		"compare-accounts",
+		"<profile A> <profile B> [root picture dir]",
+		"List local files that are in the library of profile A but not profile B",
+		2, 3,
+	)
+	matchStrategy := addMatchFlag(cmd)
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		profileA := args[0]
+		profileB := args[1]
+
+		// Setup configs
+		cfgA := config.NewConfigForProfile(profileA)
+		cfgB := config.NewConfigForProfile(profileB)
+		if filepath.Clean(cfgA.TokenFileLocation) == filepath.Clean(cfgB.TokenFileLocation) {
+			return fmt.Errorf("Profiles '%s' and '%s' use the same token file '%s'", profileA, profileB, cfgA.TokenFileLocation)
+		}
+		if filepath.Clean(cfgA.CacheDir) == filepath.Clean(cfgB.CacheDir) {
+			return fmt.Errorf("Profiles '%s' and '%s' use the same cache dir '%s'", profileA, profileB, cfgA.CacheDir)
+		}
+		rootPicturesDir := cfgA.RootPicturesDir
+		if len(args) > 2 {
+			rootPicturesDir = args[2]
+		}
+		ctx.Out.Info("Running for the following input")
+		ctx.Out.Info("Profile A: '" + profileA + "'")
+		ctx.Out.Info("Profile B: '" + profileB + "'")
+		ctx.Out.Info("Root picture dir: '" + rootPicturesDir + "'")
+
+		// Get a new Photos Client for each account
+		clientA, err := photos.NewClientForUser(ctx, cfgA)
+		if err != nil {
+			return err
+		}
+		clientB, err := photos.NewClientForUser(ctx, cfgB)
+		if err != nil {
+			return err
+		}
+
+		// the local folder is walked with the rules of profile A
+		folderRules, err := rules.ForCommand(cfgA, ctx.command.Name)
+		if err != nil {
+			return err
+		}
+		localFiles, err := ctx.scanLocalFilesWithConfig(rootPicturesDir, cfgA, folderRules)
+		if err != nil {
+			return err
+		}
+
+		// both libraries are matched the way profile A matches
+		matcherA, err := matcherForConfig(clientA, *matchStrategy, cfgA)
+		if err != nil {
+			return err
+		}
+		matcherB, err := matcherForConfig(clientB, *matchStrategy, cfgA)
+		if err != nil {
+			return err
+		}
+		mediaItemsA, err := clientA.GetAllMediaItemsWithCache()
+		if err != nil {
+			return err
+		}
+		mediaItemsB, err := clientB.GetAllMediaItemsWithCache()
+		if err != nil {
+			return err
+		}
+
+		resultA, err := matcherA.Match(localFiles, mediaItemsA)
+		if err != nil {
+			return err
+		}
+		itemsAByLocalFile := map[*files.LocalFile][]*photos.MediaItem{}
+		localFilesInA := []*files.LocalFile{}
+		for _, pair := range resultA.Matches {
+			itemsAByLocalFile[pair.LocalFile] = []*photos.MediaItem{pair.MediaItem}
+			localFilesInA = append(localFilesInA, pair.LocalFile)
+		}
+		for _, ambiguity := range resultA.Ambiguous {
+			for _, candidate := range ambiguity.Candidates {
+				itemsAByLocalFile[ambiguity.LocalFile] = append(itemsAByLocalFile[ambiguity.LocalFile], candidate.MediaItem)
+			}
+			localFilesInA = append(localFilesInA, ambiguity.LocalFile)
+		}
+		numInA := len(localFilesInA)
+
+		resultB, err := matcherB.Match(localFilesInA, mediaItemsB)
+		if err != nil {
+			return err
+		}
+		numOnlyInA := len(resultB.UnmatchedLocal)
+		for _, localFile := range resultB.UnmatchedLocal {
+			for i, item := range itemsAByLocalFile[localFile] {
+				ctx.Out.Result(
+					"only-in-a",
+					Fields{"filename": localFile.LowercaseName(), "path": localFile.Path, "url": item.ProductULR},
+					"In '%s' but not '%s' (%d): %s - %s",
+					profileA,
+					profileB,
+					i,
+					localFile.Path,
+					item.ProductULR,
+				)
+			}
+		}
+
+		log.Printf("Num local files in '%s': %d\n", profileA, numInA)
+		log.Printf("Num local files only in '%s': %d\n", profileA, numOnlyInA)
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+const bashCompletionScript = `_photosync() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    COMPREPLY=($(compgen -W "$(photosync __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}")" -- "$cur"))
+    if [ ${#COMPREPLY[@]} -eq 0 ]; then
+        COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+}
+complete -o filenames -F _photosync photosync
+`
+
+const zshCompletionScript = `autoload -U +X bashcompinit && bashcompinit
+` + bashCompletionScript
+
+func newCompletionCommand() *Command {
+	cmd := newCommand(
+		"completion",
+		"<bash|zsh>",
+		"Print a shell completion script, e.g. source <(photosync completion bash)",
+		1, 1,
+	)
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		switch args[0] {
+		case "bash":
+			fmt.Print(bashCompletionScript)
+		case "zsh":
+			fmt.Print(zshCompletionScript)
+		default:
+			return fmt.Errorf("unknown shell '%s', must be one of: bash, zsh", args[0])
+		}
+		return nil
+	}
+	return cmd
+}
+
+// completeWords returns the possible next words after the given words, which
+// are either the next word of a command name or the flags of the command
+func completeWords(commands []*Command, words []string) []string {
+	globalFlagNames := []string{}
+	globalFlagSet := flag.NewFlagSet("photosync", flag.ContinueOnError)
+	(&globalFlags{}).register(globalFlagSet)
+	globalFlagSet.VisitAll(func(f *flag.Flag) {
+		globalFlagNames = append(globalFlagNames, "--"+f.Name)
+	})
+
+	// drop flags, along with the values of global flags, to get the command
+	// name words
+	nameWords := []string{}
+	for i := 0; i < len(words); i++ {
+		if !strings.HasPrefix(words[i], "-") {
+			nameWords = append(nameWords, words[i])
+		} else if globalFlagSet.Lookup(strings.TrimLeft(words[i], "-")) != nil && !strings.Contains(words[i], "=") {
+			i += 1
+		}
+	}
+	if len(nameWords) == 1 && nameWords[0] == "help" {
+		nameWords = nil
+	}
+
+	if command, _ := findCommand(commands, nameWords); command != nil {
+		completions := append([]string{}, globalFlagNames...)
+		command.Flags.VisitAll(func(f *flag.Flag) {
+			completions = append(completions, "--"+f.Name)
+		})
+		return completions
+	}
+
+	completions := []string{}
+	seen := map[string]bool{}
+	for _, command := range commands {
+		commandWords := strings.Fields(command.Name)
+		if len(commandWords) <= len(nameWords) ||
+			strings.Join(commandWords[:len(nameWords)], " ") != strings.Join(nameWords, " ") {
+			continue
+		}
+		nextWord := commandWords[len(nameWords)]
+		if !seen[nextWord] {
+			completions = append(completions, nextWord)
+			seen[nextWord] = true
+		}
+	}
+	if len(nameWords) == 0 {
+		completions = append(completions, "help")
+		completions = append(completions, globalFlagNames...)
+	}
+	return completions
+}
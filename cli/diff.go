@@ -0,0 +1,307 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jastribl/photosync/photos"
+)
+
+func newDiffCommand() *Command {
+	cmd := newCommand(
+		"diff",
+		"<root picture dir> <album name>",
+		"Compare a local folder with an album",
+		2, 2,
+	)
+	uploadMissing := cmd.Flags.Bool("upload", false, "upload local files that aren't in Google Photos at all into the album")
+	addMissing := cmd.Flags.Bool("apply", false, "add library media items that are missing from the album")
+	removeExtra := cmd.Flags.Bool("remove-extra", false, "remove album media items that aren't in the folder, after confirmation")
+	matchStrategy := addMatchFlag(cmd)
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+		matcher, err := ctx.Matcher(client, *matchStrategy)
+		if err != nil {
+			return err
+		}
+
+		rootPicturesDir := args[0]
+		albumName := args[1]
+		ctx.Out.Info("Running for the following input")
+		ctx.Out.Info("Root picture dir: '" + rootPicturesDir + "'")
+		ctx.Out.Info("Album Name: '" + albumName + "'")
+
+		log.Println("Getting all drive files")
+		localFiles, err := ctx.ScanLocalFiles(rootPicturesDir)
+		if err != nil {
+			return err
+		}
+
+		log.Println("Getting album")
+		album, err := client.GetAlbumWithTitle(albumName)
+		if err != nil {
+			return err
+		}
+		if album == nil {
+			return errors.New("Album not found with name '" + albumName + "'")
+		}
+
+		log.Println("Getting album media items")
+		albumMediaItems, err := client.GetAllMediaItemsForAlbumWithCache(album)
+		if err != nil {
+			return err
+		}
+
+		albumResult, err := matcher.Match(localFiles, albumMediaItems)
+		if err != nil {
+			return err
+		}
+
+		// Album media items that aren't in the drive folder
+		numExtra := len(albumResult.UnmatchedRemote)
+		for _, mediaItem := range albumResult.UnmatchedRemote {
+			ctx.Out.Result(
+				"photos-extra",
+				Fields{
+					"filename":     mediaItem.Filename,
+					"creationTime": mediaItem.MediaMetadata.CreationTime,
+					"url":          mediaItem.ProductULR,
+				},
+				"Photos extra file (date: %s): %s - %s",
+				mediaItem.MediaMetadata.CreationTime,
+				mediaItem.Filename,
+				mediaItem.ProductULR,
+			)
+		}
+
+		// Local files that aren't in the album, check if we have a media item
+		// for them in the library so we can add it
+		numMissing := len(albumResult.UnmatchedLocal)
+		log.Println("Getting all library media items")
+		libraryMediaItems, err := client.GetAllMediaItemsWithCache()
+		if err != nil {
+			return err
+		}
+		libraryResult, err := matcher.Match(albumResult.UnmatchedLocal, libraryMediaItems)
+		if err != nil {
+			return err
+		}
+
+		mediaItemIDsToAdd := []string{}
+		mediaItemIDsToAddSet := map[string]bool{}
+		for _, pair := range libraryResult.Matches {
+			ctx.Out.Result(
+				"album-missing",
+				Fields{"filename": pair.LocalFile.Name(), "path": pair.LocalFile.Path, "url": pair.MediaItem.ProductULR},
+				"Link to missing in Photos: (%s): %s",
+				pair.LocalFile.Path,
+				pair.MediaItem.ProductULR,
+			)
+			if !mediaItemIDsToAddSet[pair.MediaItem.ID] {
+				mediaItemIDsToAdd = append(mediaItemIDsToAdd, pair.MediaItem.ID)
+				mediaItemIDsToAddSet[pair.MediaItem.ID] = true
+			}
+		}
+		for _, ambiguity := range libraryResult.Ambiguous {
+			reportAmbiguous(ctx, ambiguity)
+			if *addMissing {
+				log.Printf("Found multiple media items for '%s', not adding any of them\n", ambiguity.LocalFile.Path)
+			}
+		}
+
+		// Otherwise we're missing the file and don't know where to find it
+		missingFilePaths := []string{}
+		for _, localFile := range libraryResult.UnmatchedLocal {
+			ctx.Out.Result(
+				"photos-missing",
+				Fields{"filename": localFile.LowercaseName(), "path": localFile.Path},
+				"Google Photos missing file: (%s) %s",
+				localFile.LowercaseName(),
+				localFile.Path,
+			)
+			missingFilePaths = append(missingFilePaths, localFile.Path)
+		}
+
+		extraMediaItems := albumResult.UnmatchedRemote
+		log.Printf("Num Extra: %d\n", numExtra)
+		log.Printf("Num Missing: %d\n", numMissing)
+		log.Printf("Num Counted With Their Asset: %d\n", len(albumResult.Covered)+len(libraryResult.Covered))
+
+		if *removeExtra && len(extraMediaItems) > 0 {
+			err := removeExtraMediaItems(ctx, client, album, extraMediaItems)
+			if err != nil {
+				return err
+			}
+		}
+
+		if *addMissing && len(mediaItemIDsToAdd) > 0 {
+			log.Printf("Adding %d library media items to the album\n", len(mediaItemIDsToAdd))
+			err := client.BatchAddMediaItemsToAlbum(album.ID, mediaItemIDsToAdd)
+			if err != nil {
+				return err
+			}
+			log.Printf("Num Added: %d\n", len(mediaItemIDsToAdd))
+		}
+
+		if !*uploadMissing || len(missingFilePaths) == 0 {
+			return nil
+		}
+
+		return uploadMissingFiles(ctx, client, album, missingFilePaths)
+	}
+	return cmd
+}
+
+// uploadMissingFiles uploads local files into the album
+func uploadMissingFiles(
+	ctx *Context,
+	client *photos.Client,
+	album *photos.Album,
+	missingFilePaths []string,
+) error {
+	log.Printf("Uploading %d missing files\n", len(missingFilePaths))
+	newMediaItems := []*photos.NewMediaItem{}
+	uploadTokenToFilePath := map[string]string{}
+	for _, filePath := range missingFilePaths {
+		uploadToken, err := client.UploadFile(filePath)
+		if err != nil {
+			log.Printf("Failed to upload '%s': %s\n", filePath, err.Error())
+			continue
+		}
+		uploadTokenToFilePath[uploadToken] = filePath
+		newMediaItems = append(newMediaItems, &photos.NewMediaItem{
+			SimpleMediaItem: &photos.SimpleMediaItem{
+				UploadToken: uploadToken,
+				FileName:    filepath.Base(filePath),
+			},
+		})
+	}
+
+	results, err := client.BatchCreateMediaItems(album.ID, newMediaItems)
+	numUploaded := 0
+	for _, result := range results {
+		filePath := uploadTokenToFilePath[result.UploadToken]
+		if result.Succeeded() {
+			ctx.Out.Result(
+				"uploaded",
+				Fields{"path": filePath, "url": result.MediaItem.ProductULR},
+				"Uploaded: (%s) %s",
+				filePath,
+				result.MediaItem.ProductULR,
+			)
+			numUploaded += 1
+		} else {
+			message := "no media item was returned"
+			if result.Status != nil && result.Status.Message != "" {
+				message = result.Status.Message
+			}
+			ctx.Out.Result(
+				"upload-failed",
+				Fields{"path": filePath, "message": message},
+				"Failed to create media item: (%s) %s",
+				filePath,
+				message,
+			)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Num Uploaded: %d\n", numUploaded)
+	return nil
+}
+
+const removedAlbumItemsRecordFilename = "removedAlbumItems.log"
+
+type removedAlbumItemRecord struct {
+	RemovedAt    string `json:"removedAt"`
+	AlbumID      string `json:"albumId"`
+	AlbumTitle   string `json:"albumTitle"`
+	MediaItemID  string `json:"mediaItemId"`
+	Filename     string `json:"filename"`
+	CreationTime string `json:"creationTime"`
+	ProductURL   string `json:"productUrl"`
+}
+
+// removeExtraMediaItems lists the media items that would be removed from the
+// album, and only removes them after confirmation. Every removed media item is
+// appended to the removed album items record so it can be found again.
+func removeExtraMediaItems(
+	ctx *Context,
+	client *photos.Client,
+	album *photos.Album,
+	extraMediaItems []*photos.MediaItem,
+) error {
+	ctx.Out.Info("The following %d media items would be removed from the album (they stay in the library):", len(extraMediaItems))
+	for _, mediaItem := range extraMediaItems {
+		ctx.Out.Info("Would remove: %s - %s", mediaItem.Filename, mediaItem.ProductULR)
+	}
+	if !confirm(ctx, "Remove these %d media items from album '%s'?", len(extraMediaItems), album.Title) {
+		log.Println("Not removing any media items")
+		return nil
+	}
+
+	removedAlbumItemsRecordFile := filepath.Join(ctx.Config().CacheDir, removedAlbumItemsRecordFilename)
+	recordFile, err := os.OpenFile(removedAlbumItemsRecordFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer recordFile.Close()
+	encoder := json.NewEncoder(recordFile)
+
+	mediaItemIDs := []string{}
+	mediaItemsByID := map[string]*photos.MediaItem{}
+	for _, mediaItem := range extraMediaItems {
+		mediaItemIDs = append(mediaItemIDs, mediaItem.ID)
+		mediaItemsByID[mediaItem.ID] = mediaItem
+	}
+	// record each batch as soon as it is removed, so a failure part way
+	// through still leaves a record of what was removed
+	numRemoved := 0
+	err = client.BatchRemoveMediaItemsFromAlbum(album.ID, mediaItemIDs, func(removedIDs []string) error {
+		removedAt := time.Now().Format(time.RFC3339)
+		for _, mediaItemID := range removedIDs {
+			mediaItem := mediaItemsByID[mediaItemID]
+			err := encoder.Encode(removedAlbumItemRecord{
+				RemovedAt:    removedAt,
+				AlbumID:      album.ID,
+				AlbumTitle:   album.Title,
+				MediaItemID:  mediaItem.ID,
+				Filename:     mediaItem.Filename,
+				CreationTime: mediaItem.MediaMetadata.CreationTime,
+				ProductURL:   mediaItem.ProductULR,
+			})
+			if err != nil {
+				return err
+			}
+			ctx.Out.Result(
+				"removed",
+				Fields{"mediaItemId": mediaItem.ID, "filename": mediaItem.Filename, "url": mediaItem.ProductULR},
+				"Removed: %s - %s",
+				mediaItem.Filename,
+				mediaItem.ProductULR,
+			)
+			numRemoved += 1
+		}
+		return nil
+	})
+	log.Printf("Num Removed: %d (recorded in %s)\n", numRemoved, removedAlbumItemsRecordFile)
+	return err
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no
+func confirm(ctx *Context, questionFormat string, questionArgs ...interface{}) bool {
+	ctx.Out.Prompt(questionFormat+" [y/N]: ", questionArgs...)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.ToLower(strings.TrimSpace(answer)) == "y"
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jastribl/photosync/rules"
+)
+
+func newExplainCommand() *Command {
+	cmd := newCommand(
+		"explain",
+		"<root picture dir> <path>...",
+		"Show why paths are included or skipped when walking the root picture dir",
+		2, -1,
+	)
+	commandName := cmd.Flags.String("for", "", "use the folder rules of this command instead of the default ones")
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		rootPicturesDir := args[0]
+		rootPicturesDirAbs, err := filepath.Abs(rootPicturesDir)
+		if err != nil {
+			return err
+		}
+
+		// no command has an empty name, so that gets the default rules
+		folderRules, err := rules.ForCommand(ctx.Config(), *commandName)
+		if err != nil {
+			return err
+		}
+
+		for _, pathArg := range args[1:] {
+			// paths are either absolute or relative to the root picture dir
+			fullPath := pathArg
+			if !filepath.IsAbs(fullPath) {
+				fullPath = filepath.Join(rootPicturesDirAbs, fullPath)
+			}
+			relPath, err := filepath.Rel(rootPicturesDirAbs, fullPath)
+			if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("'%s' is not under the root picture dir '%s'", pathArg, rootPicturesDir)
+			}
+			info, err := os.Stat(fullPath)
+			if err != nil {
+				return err
+			}
+
+			decision, err := rules.ExplainPath(rootPicturesDirAbs, relPath, info.IsDir(), folderRules)
+			if err != nil {
+				return err
+			}
+			result := "included"
+			if decision.Skip {
+				result = "skipped"
+			}
+			ctx.Out.Result(
+				"explain",
+				Fields{"path": fullPath, "skipped": decision.Skip, "reason": decision.Reason},
+				"%s: %s (%s)",
+				fullPath,
+				result,
+				decision.Reason,
+			)
+		}
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/jastribl/photosync/config"
+	"github.com/jastribl/photosync/labelling"
+	"github.com/jastribl/photosync/photos"
+)
+
+const createdLabelsRecordFilename = "albumLabels.json"
+
+func newLabelCommand() *Command {
+	cmd := newCommand(
+		"label",
+		"<root picture dir> <album name>",
+		"Add a text label to an album before the media items of each folder",
+		2, 2,
+	)
+	createLabels := cmd.Flags.Bool("create", false, "actually add the labels instead of only listing them")
+	relabel := cmd.Flags.Bool("relabel", false, "add labels again that were added somewhere else in the album or with other text before, listing the old ones to remove")
+	depth := cmd.Flags.Int("depth", 0, "how deep the folders get labelled (default from the config's label-depth, or 1 for the top level folders)")
+	template := cmd.Flags.String("template", "", "text of the top level folders' labels (default from the config's label-template, or \"{folder}\")")
+	subTemplate := cmd.Flags.String("sub-template", "", "text of the labels of the folders in them (default from the config's sub-label-template, or the top level template)")
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+
+		rootPicturesDir := args[0]
+		albumName := args[1]
+		ctx.Out.Info("Running for the following input")
+		ctx.Out.Info("Root picture dir: '" + rootPicturesDir + "'")
+
+		album, err := client.GetAlbumWithTitle(albumName)
+		if err != nil {
+			return err
+		}
+		if album == nil {
+			return errors.New("Album not found with name '" + albumName + "'")
+		}
+
+		localFiles, err := ctx.ScanLocalFiles(rootPicturesDir)
+		if err != nil {
+			return err
+		}
+		*depth, *template, *subTemplate = labelSettings(ctx.Config(), *depth, *template, *subTemplate)
+		listOfFolderInfo, err := labelling.GetFolderInfo(
+			rootPicturesDir,
+			client,
+			album,
+			localFiles,
+			ctx.FilenameEquivalence(),
+			*depth,
+		)
+		if err != nil {
+			return err
+		}
+
+		record, err := labelling.OpenRecord(filepath.Join(ctx.Config().CacheDir, createdLabelsRecordFilename))
+		if err != nil {
+			return err
+		}
+		labelFolders := map[string]bool{}
+		// addedFolders are the folders whose labels are (re)added in this run,
+		// so the labels going right after them need to be added again too
+		addedFolders := map[string]bool{}
+		staleLabels := []*labelling.CreatedLabel{}
+		for _, label := range labelling.GetLabels(listOfFolderInfo, *template, *subTemplate) {
+			labelFolders[label.Folder] = true
+			afterMediaItemID := ""
+			if label.AfterMediaItem != nil {
+				afterMediaItemID = label.AfterMediaItem.ID
+			}
+			afterLabelFolder := ""
+			if label.AfterLabel != nil {
+				afterLabelFolder = label.AfterLabel.Folder
+			}
+			if createdLabel := record.Get(album.ID, label.Folder); createdLabel != nil {
+				samePlace := createdLabel.AfterMediaItemID == afterMediaItemID &&
+					createdLabel.AfterLabelFolder == afterLabelFolder &&
+					!addedFolders[afterLabelFolder]
+				if samePlace && createdLabel.Text == label.Text {
+					ctx.Out.Result(
+						"label-exists",
+						Fields{"text": label.Text, "folder": label.Folder, "enrichmentId": createdLabel.EnrichmentID},
+						"Already added '%s'",
+						label.Text,
+					)
+					continue
+				}
+				if !*relabel {
+					ctx.Out.Result(
+						"label-moved",
+						Fields{"text": label.Text, "oldText": createdLabel.Text, "folder": label.Folder, "enrichmentId": createdLabel.EnrichmentID},
+						"'%s' was added as '%s' or somewhere else in the album, pass --relabel to add it again",
+						label.Text,
+						createdLabel.Text,
+					)
+					continue
+				}
+				staleLabels = append(staleLabels, createdLabel)
+			}
+			addedFolders[label.Folder] = true
+
+			switch {
+			case label.AfterLabel != nil:
+				ctx.Out.Result(
+					"label",
+					Fields{"text": label.Text, "folder": label.Folder, "afterLabel": label.AfterLabel.Text, "created": *createLabels},
+					"Adding '%s' right after '%s'",
+					label.Text,
+					label.AfterLabel.Text,
+				)
+			case label.AfterMediaItem == nil:
+				ctx.Out.Result(
+					"label",
+					Fields{"text": label.Text, "folder": label.Folder, "created": *createLabels},
+					"Adding '%s' at the beginning of the album",
+					label.Text,
+				)
+			default:
+				if label.AfterMediaItem.ID == "" {
+					return errors.New("Got empty media id for: " + label.AfterMediaItem.Filename)
+				}
+				ctx.Out.Result(
+					"label",
+					Fields{"text": label.Text, "folder": label.Folder, "afterFilename": label.AfterMediaItem.Filename, "created": *createLabels},
+					"Adding '%s' after '%s'",
+					label.Text,
+					label.AfterMediaItem.Filename,
+				)
+			}
+			if !*createLabels {
+				continue
+			}
+			var response *photos.AddEnrichmentResponse
+			if label.AfterLabel != nil {
+				afterLabel := record.Get(album.ID, label.AfterLabel.Folder)
+				if afterLabel == nil || afterLabel.EnrichmentID == "" {
+					return errors.New("No enrichment id recorded for the label of: " + label.AfterLabel.Folder)
+				}
+				response, err = client.AddTextEnrichmentToAlbumAfterEnrichment(album.ID, afterLabel.EnrichmentID, label.Text)
+			} else {
+				response, err = client.AddTextEnrichmentToAlbum(album.ID, label.AfterMediaItem, label.Text)
+			}
+			if err != nil {
+				return err
+			}
+			enrichmentID := ""
+			if response.EnrichmentItem != nil {
+				enrichmentID = response.EnrichmentItem.ID
+			}
+			record.Put(&labelling.CreatedLabel{
+				AlbumID:          album.ID,
+				AlbumTitle:       album.Title,
+				Folder:           label.Folder,
+				Text:             label.Text,
+				EnrichmentID:     enrichmentID,
+				AfterMediaItemID: afterMediaItemID,
+				AfterLabelFolder: afterLabelFolder,
+				CreatedAt:        time.Now().Format(time.RFC3339),
+			})
+			// save as we go so a failure part way through doesn't lead to
+			// labels getting added twice
+			if err := record.Save(); err != nil {
+				return err
+			}
+		}
+
+		if !*relabel {
+			return nil
+		}
+		// The API can't remove labels, so the old ones have to be removed by
+		// hand
+		for _, createdLabel := range record.ForAlbum(album.ID) {
+			if !labelFolders[createdLabel.Folder] {
+				staleLabels = append(staleLabels, createdLabel)
+				if *createLabels {
+					record.Remove(createdLabel)
+				}
+			}
+		}
+		for _, createdLabel := range staleLabels {
+			ctx.Out.Result(
+				"label-remove",
+				Fields{"text": createdLabel.Text, "enrichmentId": createdLabel.EnrichmentID, "url": album.ProductULR},
+				"Remove the old '%s' label by hand (added %s): %s",
+				createdLabel.Text,
+				createdLabel.CreatedAt,
+				album.ProductULR,
+			)
+		}
+		if *createLabels {
+			return record.Save()
+		}
+		return nil
+	}
+	return cmd
+}
+
+// labelSettings gets the label depth and templates, using the config for the
+// ones that weren't passed and then the defaults
+func labelSettings(cfg *config.Config, depth int, template, subTemplate string) (int, string, string) {
+	if depth == 0 {
+		depth = cfg.LabelDepth
+	}
+	if depth == 0 {
+		depth = labelling.DefaultDepth
+	}
+	if template == "" {
+		template = cfg.LabelTemplate
+	}
+	if template == "" {
+		template = labelling.DefaultTemplate
+	}
+	if subTemplate == "" {
+		subTemplate = cfg.SubLabelTemplate
+	}
+	if subTemplate == "" {
+		subTemplate = template
+	}
+	return depth, template, subTemplate
+}
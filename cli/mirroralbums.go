@@ -0,0 +1,309 @@
+package cli
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+
+	"github.com/jastribl/photosync/files"
+	"github.com/jastribl/photosync/mirror"
+	"github.com/jastribl/photosync/photos"
+)
+
+const albumMirrorMappingFilename = "albumMirror.json"
+
+func newMirrorAlbumsCommand() *Command {
+	cmd := newCommand(
+		"mirror-albums",
+		"[root picture dir]",
+		"Make an album for each local folder and add the folder's library media items to it",
+		0, 1,
+	)
+	depth := cmd.Flags.Int("depth", 0, "depth of the folders to make albums for (default from the config's mirror-albums-depth, or 1 for the top level folders)")
+	apply := cmd.Flags.Bool("apply", false, "actually create the albums and add the media items instead of only listing them")
+	matchStrategy := addMatchFlag(cmd)
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		cfg := ctx.Config()
+		rootPicturesDir := cfg.RootPicturesDir
+		if len(args) > 0 {
+			rootPicturesDir = args[0]
+		}
+		if rootPicturesDir == "" {
+			return errors.New("No root picture dir, pass one or set root-pictures-dir in the config")
+		}
+		if *depth == 0 {
+			*depth = cfg.MirrorAlbumsDepth
+		}
+		if *depth == 0 {
+			*depth = mirror.DefaultDepth
+		}
+		ctx.Out.Info("Running for the following input")
+		ctx.Out.Info("Root picture dir: '" + rootPicturesDir + "'")
+
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+		matcher, err := ctx.Matcher(client, *matchStrategy)
+		if err != nil {
+			return err
+		}
+		mapping, err := mirror.LoadMapping(filepath.Join(cfg.CacheDir, albumMirrorMappingFilename), rootPicturesDir, *depth)
+		if err != nil {
+			return err
+		}
+
+		log.Println("Getting all drive files")
+		localFiles, err := ctx.ScanLocalFiles(rootPicturesDir)
+		if err != nil {
+			return err
+		}
+		folders, filesByFolder, looseFiles := mirror.GroupByFolder(localFiles, *depth)
+		if len(looseFiles) > 0 {
+			log.Printf("Not mirroring %d files that aren't in a folder %d deep\n", len(looseFiles), *depth)
+		}
+
+		log.Println("Getting all library media items")
+		libraryMediaItems, err := client.GetAllMediaItemsWithCache()
+		if err != nil {
+			return err
+		}
+		folderFiles := []*files.LocalFile{}
+		for _, folder := range folders {
+			folderFiles = append(folderFiles, filesByFolder[folder]...)
+		}
+		result, err := matcher.Match(folderFiles, libraryMediaItems)
+		if err != nil {
+			return err
+		}
+		mediaItemIDsByFolder := map[string][]string{}
+		seenByFolder := map[string]map[string]bool{}
+		for _, pair := range result.Matches {
+			folder := mirror.FolderAt(pair.LocalFile.RelPath, *depth)
+			if seenByFolder[folder] == nil {
+				seenByFolder[folder] = map[string]bool{}
+			}
+			if !seenByFolder[folder][pair.MediaItem.ID] {
+				seenByFolder[folder][pair.MediaItem.ID] = true
+				mediaItemIDsByFolder[folder] = append(mediaItemIDsByFolder[folder], pair.MediaItem.ID)
+			}
+		}
+		for _, ambiguity := range result.Ambiguous {
+			reportAmbiguous(ctx, ambiguity)
+		}
+		for _, localFile := range result.UnmatchedLocal {
+			ctx.Out.Result(
+				"photos-missing",
+				Fields{"filename": localFile.LowercaseName(), "path": localFile.Path},
+				"Google Photos missing file: (%s) %s",
+				localFile.LowercaseName(),
+				localFile.Path,
+			)
+		}
+
+		albums, err := client.GetAllAlbumsWithCache()
+		if err != nil {
+			return err
+		}
+		albumsByID := map[string]*photos.Album{}
+		for _, album := range albums {
+			albumsByID[album.ID] = album
+		}
+
+		// Mapped folders that are gone, whose albums a renamed folder can take
+		localFolders := map[string]bool{}
+		for _, folder := range folders {
+			localFolders[folder] = true
+		}
+		goneEntries := []*mirror.Entry{}
+		for _, entry := range mapping.Entries() {
+			if !localFolders[entry.Folder] && albumsByID[entry.AlbumID] != nil {
+				goneEntries = append(goneEntries, entry)
+			}
+		}
+
+		numCreated := 0
+		numAdded := 0
+		numExtra := 0
+		for _, folder := range folders {
+			mediaItemIDs := mediaItemIDsByFolder[folder]
+			album, err := findMirrorAlbum(ctx, client, mapping, albumsByID, folder, mediaItemIDs, &goneEntries)
+			if err != nil {
+				return err
+			}
+
+			if album != nil && !album.IsWritable {
+				ctx.Out.Result(
+					"album-not-writable",
+					Fields{"folder": folder, "album": album.Title, "albumId": album.ID},
+					"Album '%s' for folder '%s' wasn't created by photosync so can't be added to, skipping it",
+					album.Title,
+					folder,
+				)
+				continue
+			}
+			if album == nil {
+				ctx.Out.Result(
+					"album-create",
+					Fields{"folder": folder, "numMediaItems": len(mediaItemIDs), "created": *apply},
+					"Creating album '%s' with %d media items",
+					folder,
+					len(mediaItemIDs),
+				)
+				if !*apply {
+					continue
+				}
+				album, err = client.CreateAlbum(folder)
+				if err != nil {
+					return err
+				}
+				if album == nil || album.ID == "" {
+					return errors.New("error creating album")
+				}
+				albumsByID[album.ID] = album
+				numCreated += 1
+			}
+			mapping.Put(&mirror.Entry{Folder: folder, AlbumID: album.ID, AlbumTitle: album.Title})
+			if *apply {
+				// saved as it goes so a failure part way doesn't lose the
+				// albums already created
+				if err := mapping.Save(); err != nil {
+					return err
+				}
+			}
+
+			albumMediaItems, err := client.GetAllMediaItemsForAlbumWithCache(album)
+			if err != nil {
+				return err
+			}
+			inAlbum := map[string]bool{}
+			for _, mediaItem := range albumMediaItems {
+				inAlbum[mediaItem.ID] = true
+				if !seenByFolder[folder][mediaItem.ID] {
+					ctx.Out.Result(
+						"album-extra",
+						Fields{"folder": folder, "album": album.Title, "filename": mediaItem.Filename, "url": mediaItem.ProductULR},
+						"In album '%s' but not the folder: %s - %s",
+						album.Title,
+						mediaItem.Filename,
+						mediaItem.ProductULR,
+					)
+					numExtra += 1
+				}
+			}
+			mediaItemIDsToAdd := []string{}
+			for _, mediaItemID := range mediaItemIDs {
+				if !inAlbum[mediaItemID] {
+					mediaItemIDsToAdd = append(mediaItemIDsToAdd, mediaItemID)
+				}
+			}
+			if len(mediaItemIDsToAdd) == 0 {
+				continue
+			}
+			ctx.Out.Result(
+				"album-add",
+				Fields{"folder": folder, "album": album.Title, "numMediaItems": len(mediaItemIDsToAdd), "added": *apply},
+				"Adding %d media items to album '%s'",
+				len(mediaItemIDsToAdd),
+				album.Title,
+			)
+			if !*apply {
+				continue
+			}
+			err = client.BatchAddMediaItemsToAlbum(album.ID, mediaItemIDsToAdd)
+			if err != nil {
+				return err
+			}
+			numAdded += len(mediaItemIDsToAdd)
+		}
+
+		for _, entry := range goneEntries {
+			ctx.Out.Result(
+				"folder-gone",
+				Fields{"folder": entry.Folder, "album": entry.AlbumTitle, "albumId": entry.AlbumID},
+				"Folder '%s' is gone, its album '%s' is kept",
+				entry.Folder,
+				entry.AlbumTitle,
+			)
+		}
+
+		log.Printf("Num Folders: %d\n", len(folders))
+		log.Printf("Num Albums Created: %d\n", numCreated)
+		log.Printf("Num Added: %d\n", numAdded)
+		log.Printf("Num Extra: %d\n", numExtra)
+		return nil
+	}
+	return cmd
+}
+
+// findMirrorAlbum finds the album mirroring a folder: the one it was mapped to
+// before, otherwise one with the folder as its title, otherwise the album of a
+// mapped folder that is gone and shares media items with it, which is taken
+// to be the same folder renamed. It returns nil if there is no such album.
+func findMirrorAlbum(
+	ctx *Context,
+	client *photos.Client,
+	mapping *mirror.Mapping,
+	albumsByID map[string]*photos.Album,
+	folder string,
+	mediaItemIDs []string,
+	goneEntries *[]*mirror.Entry,
+) (*photos.Album, error) {
+	if entry := mapping.Get(folder); entry != nil {
+		if album := albumsByID[entry.AlbumID]; album != nil {
+			if album.Title != folder {
+				ctx.Out.Result(
+					"album-renamed",
+					Fields{"folder": folder, "album": album.Title, "albumId": album.ID},
+					"Album for folder '%s' is titled '%s'",
+					folder,
+					album.Title,
+				)
+			}
+			return album, nil
+		}
+		log.Printf("Album mapped to folder '%s' is gone\n", folder)
+	}
+
+	album, err := client.GetAlbumWithTitle(folder)
+	if err != nil || album != nil {
+		return album, err
+	}
+
+	inFolder := map[string]bool{}
+	for _, mediaItemID := range mediaItemIDs {
+		inFolder[mediaItemID] = true
+	}
+	bestIndex, bestOverlap := -1, 0
+	for i, entry := range *goneEntries {
+		albumMediaItems, err := client.GetAllMediaItemsForAlbumWithCache(albumsByID[entry.AlbumID])
+		if err != nil {
+			return nil, err
+		}
+		overlap := 0
+		for _, mediaItem := range albumMediaItems {
+			if inFolder[mediaItem.ID] {
+				overlap += 1
+			}
+		}
+		if overlap > bestOverlap {
+			bestIndex, bestOverlap = i, overlap
+		}
+	}
+	if bestIndex == -1 {
+		return nil, nil
+	}
+	entry := (*goneEntries)[bestIndex]
+	*goneEntries = append((*goneEntries)[:bestIndex], (*goneEntries)[bestIndex+1:]...)
+	mapping.Remove(entry.Folder)
+	ctx.Out.Result(
+		"folder-renamed",
+		Fields{"folder": folder, "oldFolder": entry.Folder, "album": entry.AlbumTitle, "albumId": entry.AlbumID},
+		"Folder '%s' looks like '%s' renamed, using its album '%s'",
+		folder,
+		entry.Folder,
+		entry.AlbumTitle,
+	)
+	return albumsByID[entry.AlbumID], nil
+}
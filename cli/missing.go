@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/jastribl/photosync/download"
+	"github.com/jastribl/photosync/photos"
+)
+
+func newMissingLocalCommand() *Command {
+	cmd := newCommand(
+		"missing local",
+		"",
+		"List library media items that aren't anywhere in the root pictures dir",
+		0, 0,
+	)
+	matchStrategy := addMatchFlag(cmd)
+	downloadMissing := cmd.Flags.Bool("download", false, "download the missing media items into the root pictures dir")
+	layout := cmd.Flags.String(
+		"layout",
+		"",
+		"folder under the root pictures dir to download into, with {year}, {month} and {day} from the creation date (default from the config's download-layout)",
+	)
+	workers := cmd.Flags.Int("workers", 0, "how many media items to download at once (default from the config's download-workers)")
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+		matcher, err := ctx.Matcher(client, *matchStrategy)
+		if err != nil {
+			return err
+		}
+
+		localFiles, err := ctx.ScanLocalFiles(ctx.Config().RootPicturesDir)
+		if err != nil {
+			return err
+		}
+
+		allPhotosMediaItems, err := client.GetAllMediaItemsWithCache()
+		if err != nil {
+			return err
+		}
+
+		result, err := matcher.Match(localFiles, allPhotosMediaItems)
+		if err != nil {
+			return err
+		}
+		for _, ambiguity := range result.Ambiguous {
+			reportAmbiguous(ctx, ambiguity)
+		}
+		for _, mediaItem := range result.UnmatchedRemote {
+			ctx.Out.Result(
+				"local-missing",
+				Fields{
+					"filename":     mediaItem.Filename,
+					"creationTime": mediaItem.MediaMetadata.CreationTime,
+					"url":          mediaItem.ProductULR,
+				},
+				"Missing locally: (%s) (%s): %s",
+				mediaItem.MediaMetadata.CreationTime,
+				mediaItem.Filename,
+				mediaItem.ProductULR,
+			)
+		}
+
+		if !*downloadMissing || len(result.UnmatchedRemote) == 0 {
+			return nil
+		}
+		return downloadMissingMediaItems(ctx, client, result.UnmatchedRemote, *layout, *workers)
+	}
+	return cmd
+}
+
+const downloadedMediaItemsRecordFilename = "downloadedMediaItems.log"
+
+// downloadMissingMediaItems downloads media items into the root pictures dir,
+// skipping the ones that were downloaded before. Downloads that were
+// interrupted are resumed.
+func downloadMissingMediaItems(
+	ctx *Context,
+	client *photos.Client,
+	mediaItems []*photos.MediaItem,
+	layout string,
+	workers int,
+) error {
+	cfg := ctx.Config()
+	if layout == "" {
+		layout = cfg.DownloadLayout
+	}
+	if layout == "" {
+		layout = download.DefaultLayout
+	}
+	if workers == 0 {
+		workers = cfg.DownloadWorkers
+	}
+
+	record, err := download.OpenRecord(filepath.Join(cfg.CacheDir, downloadedMediaItemsRecordFilename))
+	if err != nil {
+		return err
+	}
+	planner := download.NewIDSuffixPlanner()
+	jobs := []*download.Job{}
+	for _, mediaItem := range mediaItems {
+		if path, downloaded := record.Downloaded(mediaItem.ID); downloaded {
+			log.Printf("Already downloaded '%s' to %s\n", mediaItem.Filename, path)
+			continue
+		}
+		folder, err := download.ExpandLayout(layout, mediaItem)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, planner.Plan(mediaItem, filepath.Join(cfg.RootPicturesDir, folder)))
+	}
+
+	log.Printf("Downloading %d missing media items\n", len(jobs))
+	numDownloaded := 0
+	var recordErr error
+	err = download.Run(ctx, client, jobs, workers, func(result *download.Result) {
+		if result.Err != nil {
+			ctx.Out.Result(
+				"download-failed",
+				Fields{"filename": result.MediaItem.Filename, "url": result.MediaItem.ProductULR, "error": result.Err.Error()},
+				"Failed to download: (%s) %s",
+				result.MediaItem.Filename,
+				result.Err.Error(),
+			)
+			return
+		}
+		if err := record.Add(result.Job); err != nil && recordErr == nil {
+			recordErr = err
+		}
+		ctx.Out.Result(
+			"downloaded",
+			Fields{"filename": result.MediaItem.Filename, "path": result.Path, "resumed": result.Resumed},
+			"Downloaded: %s",
+			result.Path,
+		)
+		numDownloaded += 1
+	})
+	log.Printf("Num Downloaded: %d\n", numDownloaded)
+	if err != nil {
+		return err
+	}
+	return recordErr
+}
+
+func newMissingPhotosCommand() *Command {
+	cmd := newCommand(
+		"missing photos",
+		"<root picture dir>",
+		"List local files that aren't anywhere in the Google Photos library",
+		1, 1,
+	)
+	matchStrategy := addMatchFlag(cmd)
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+		matcher, err := ctx.Matcher(client, *matchStrategy)
+		if err != nil {
+			return err
+		}
+
+		rootPicturesDir := args[0]
+		ctx.Out.Info("Running for the following input")
+		ctx.Out.Info("Root picture dir: '" + rootPicturesDir + "'")
+
+		localFiles, err := ctx.ScanLocalFiles(rootPicturesDir)
+		if err != nil {
+			return err
+		}
+
+		allPhotosMediaItems, err := client.GetAllMediaItemsWithCache()
+		if err != nil {
+			return err
+		}
+
+		result, err := matcher.Match(localFiles, allPhotosMediaItems)
+		if err != nil {
+			return err
+		}
+		for _, ambiguity := range result.Ambiguous {
+			reportAmbiguous(ctx, ambiguity)
+		}
+		if len(result.Covered) > 0 {
+			ctx.Out.Info(
+				"%d files count as present since the main file of their Live Photo, burst or RAW+JPEG pair is in the library",
+				len(result.Covered),
+			)
+		}
+		for _, localFile := range result.UnmatchedLocal {
+			ctx.Out.Result(
+				"photos-missing",
+				Fields{"filename": localFile.LowercaseName(), "path": localFile.Path},
+				"Photos missing: %s",
+				localFile.Path,
+			)
+		}
+		return nil
+	}
+	return cmd
+}
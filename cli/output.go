@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Fields are the structured fields of a result, used for JSON output
+type Fields map[string]interface{}
+
+// Output writes command results in the chosen format. Text output prints each
+// result's text line, JSON output prints each result as a JSON object on its
+// own line with a "type" field naming the kind of result.
+type Output struct {
+	w      io.Writer
+	format string
+}
+
+func newOutput(format string, w io.Writer) (*Output, error) {
+	if format != "text" && format != "json" {
+		return nil, fmt.Errorf("unknown output format '%s', must be one of: text, json", format)
+	}
+	return &Output{w: w, format: format}, nil
+}
+
+// IsJSON returns if the output is JSON
+func (o *Output) IsJSON() bool {
+	return o.format == "json"
+}
+
+// Result writes a single result
+func (o *Output) Result(kind string, fields Fields, textFormat string, textArgs ...interface{}) {
+	if o.IsJSON() {
+		record := Fields{"type": kind}
+		for key, value := range fields {
+			record[key] = value
+		}
+		json.NewEncoder(o.w).Encode(record)
+		return
+	}
+	fmt.Fprintf(o.w, textFormat+"\n", textArgs...)
+}
+
+// Info writes a line of information that isn't a result, which goes to stderr
+// for JSON output so that stdout stays parseable
+func (o *Output) Info(textFormat string, textArgs ...interface{}) {
+	o.Prompt(textFormat+"\n", textArgs...)
+}
+
+// Prompt writes text for the user without ending the line, going to the same
+// place as Info
+func (o *Output) Prompt(textFormat string, textArgs ...interface{}) {
+	w := o.w
+	if o.IsJSON() {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, textFormat, textArgs...)
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jastribl/photosync/files"
+)
+
+func newSortCommand() *Command {
+	cmd := newCommand(
+		"sort",
+		"<root picture dir>",
+		"Move the local files in the root dir into a folder per day, using the creation time of their media item",
+		1, 1,
+	)
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+
+		rootPicturesDir := args[0]
+
+		localFiles, err := ctx.ScanLocalFiles(rootPicturesDir)
+		if err != nil {
+			return err
+		}
+
+		for _, localFile := range localFiles {
+			// only the files loose in the root get sorted, folders are left
+			// as they are
+			if strings.Contains(localFile.RelPath, "/") {
+				continue
+			}
+			filename := localFile.Name()
+			mediaItems, err := client.GetMediaItemsWithLowercaseFilenameWithCache(localFile.LowercaseName())
+			if err != nil {
+				return err
+			}
+			if len(mediaItems) > 0 {
+				if len(mediaItems) > 1 {
+					log.Printf("Found multiple media items for '%s', leaving untouched\n", localFile.Path)
+					continue
+				}
+
+				newFolderPath := filepath.Join(rootPicturesDir, mediaItems[0].MediaMetadata.CreationTime[:10])
+				if !files.FileExists(newFolderPath) {
+					err := os.Mkdir(newFolderPath, 0777)
+					if err != nil {
+						return err
+					}
+					log.Printf("Created folder: %s\n", newFolderPath)
+				}
+				newPath := filepath.Join(newFolderPath, filename)
+				if newPath == localFile.Path {
+					continue
+				}
+				if files.FileExists(newPath) {
+					log.Printf("There is already a file at '%s', leaving '%s' untouched\n", newPath, localFile.Path)
+					continue
+				}
+				err := os.Rename(localFile.Path, newPath)
+				if err != nil {
+					return err
+				}
+				ctx.Out.Result(
+					"moved",
+					Fields{"path": localFile.Path, "newPath": newPath},
+					"Moved '%s' into folder '%s'",
+					localFile.Path,
+					newFolderPath,
+				)
+				continue
+			}
+
+			log.Printf("Unable to find Google drive photo '%s', leaving untouched\n", localFile.Path)
+		}
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/jastribl/photosync/files"
+)
+
+func newSpaceSaverCommand() *Command {
+	cmd := newCommand(
+		"spacesaver",
+		"",
+		"List media items after free-before-date that aren't stored locally, which take up storage space",
+		0, 0,
+	)
+
+	cmd.Run = func(ctx *Context, args []string) error {
+		client, err := ctx.Client()
+		if err != nil {
+			return err
+		}
+		cfg := ctx.Config()
+
+		localFiles, err := ctx.ScanLocalFiles(cfg.RootPicturesDir)
+		if err != nil {
+			return err
+		}
+		equivalence := ctx.FilenameEquivalence()
+		stemToLocalFiles := map[string][]*files.LocalFile{}
+		for _, localFile := range localFiles {
+			stem := equivalence.Stem(localFile.Name())
+			stemToLocalFiles[stem] = append(stemToLocalFiles[stem], localFile)
+		}
+
+		mediaItmes, err := client.GetAllMediaItemsWithCache()
+		if err != nil {
+			return err
+		}
+
+		freeBefore, _ := time.Parse("2006-01-02", cfg.FreeBeforeDate)
+
+		for _, mediaItem := range mediaItmes {
+			found := false
+			for _, localFile := range stemToLocalFiles[equivalence.Stem(mediaItem.Filename)] {
+				found = found || equivalence.Equivalent(localFile.Name(), mediaItem.Filename)
+			}
+			if !found {
+				timeOfImage, err := time.Parse(
+					"2006-01-02T15:04:05Z",
+					mediaItem.MediaMetadata.CreationTime,
+				)
+				if err != nil {
+					return err
+				}
+				if timeOfImage.After(freeBefore) {
+					ctx.Out.Result(
+						"space-saver",
+						Fields{"filename": mediaItem.Filename, "url": mediaItem.ProductULR},
+						"%s",
+						mediaItem.ProductULR,
+					)
+				}
+			}
+		}
+		return nil
+	}
+	return cmd
+}
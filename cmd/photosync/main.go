@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/jastribl/photosync/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:]))
+}
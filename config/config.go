@@ -4,13 +4,22 @@ import (
 	"encoding/json"
 	"log"
 	"os"
-	"regexp"
+	"path/filepath"
+	"strings"
 )
 
 // Config is the struct that holds splitwise config info
 type Config struct {
-	TokenFileLocation string    `json:"token-file-location"`
-	TokenDoneSignal   chan bool `json:"-"`
+	// Profile is the name of the profile this config is for, empty for the
+	// top level settings
+	Profile string `json:"-"`
+	// Profiles holds the settings of every named profile, each one overriding
+	// whichever top level settings it has
+	Profiles map[string]json.RawMessage `json:"profiles"`
+
+	TokenFileLocation string `json:"token-file-location"`
+	// CacheDir is where cached media items, albums and records are kept
+	CacheDir string `json:"cache-dir"`
 
 	// OAuth config
 	ClientID     string   `json:"client-id"`
@@ -19,39 +28,193 @@ type Config struct {
 	AuthURL      string   `json:"auth-url"`
 	TokenURL     string   `json:"token-url"`
 	RedirectURL  string   `json:"redirect-url"`
+	// AuthFlow is how to get a token when there isn't one, one of "browser"
+	// (the default), "paste" or "device"
+	AuthFlow string `json:"auth-flow"`
+	// AuthListenPort overrides the port of the redirect URL for the browser
+	// auth flow's loopback listener
+	AuthListenPort int    `json:"auth-listen-port"`
+	DeviceAuthURL  string `json:"device-auth-url"`
 
 	// Program Config
-	FreeBeforeDate                string           `json:"free-before-date"`
-	RootPicturesDir               string           `json:"root-pictures-dir"`
-	PicturePathSubstringsToIgnore []string         `json:"picture-path-substrings-to-ignore"`
-	PicturePathRegexsToIgnore     []*regexp.Regexp `json:"-"`
+	FreeBeforeDate  string `json:"free-before-date"`
+	RootPicturesDir string `json:"root-pictures-dir"`
+	// PicturePathSubstringsToIgnore are folder name regexes that are denied for
+	// every command using the default folder rules, prefer FolderRuleSets
+	PicturePathSubstringsToIgnore []string `json:"picture-path-substrings-to-ignore"`
+	// FullCacheSyncDays is how often the media items cache is fully re-fetched
+	// instead of only fetching new media items
+	FullCacheSyncDays int `json:"full-cache-sync-days"`
+	// ScanWorkers is how many local dirs get read at once
+	ScanWorkers int `json:"scan-workers"`
+	// FollowSymlinks makes symlinked local dirs get scanned as well
+	FollowSymlinks bool `json:"follow-symlinks"`
+	// MatchStrategy is how local files are matched with media items when a
+	// command isn't given one, see match.Strategy
+	MatchStrategy string `json:"match-strategy"`
+	// ExtensionGroups are groups of file extensions that are the same picture,
+	// like {"heic", "jpg"}, files.DefaultExtensionGroups when missing
+	ExtensionGroups [][]string `json:"extension-groups"`
+	// FilenameSuffixes are removed from the end of filenames before comparing
+	// them, like "-edited", files.DefaultFilenameSuffixes when missing
+	FilenameSuffixes []string `json:"filename-suffixes"`
+	// DownloadLayout is the folder under RootPicturesDir that missing media
+	// items get downloaded into, where {year}, {month} and {day} are replaced
+	// with the media item's creation date
+	DownloadLayout string `json:"download-layout"`
+	// DownloadWorkers is how many media items get downloaded at once
+	DownloadWorkers int `json:"download-workers"`
+	// BackupDir is where the backup command mirrors the library to
+	BackupDir string `json:"backup-dir"`
+	// BackupLayout is the folder under BackupDir that each media item is backed
+	// up into, with the same placeholders as DownloadLayout
+	BackupLayout string `json:"backup-layout"`
+	// MirrorAlbumsDepth is the depth of the folders that mirror-albums makes an
+	// album for, 0 for mirror.DefaultDepth (the top level folders)
+	MirrorAlbumsDepth int `json:"mirror-albums-depth"`
+	// LabelDepth is how deep the label command labels folders, 0 for
+	// labelling.DefaultDepth (the top level folders)
+	LabelDepth int `json:"label-depth"`
+	// LabelTemplate is the text of the top level folders' labels, where
+	// {folder}, {path}, {date range} and {count} are replaced with the
+	// folder's details, labelling.DefaultTemplate when missing
+	LabelTemplate string `json:"label-template"`
+	// SubLabelTemplate is the text of the labels of the folders in them,
+	// LabelTemplate when missing
+	SubLabelTemplate string `json:"sub-label-template"`
+	// MatchMinScore is the lowest score the score match strategy accepts, 0
+	// for match.DefaultMinScore
+	MatchMinScore int `json:"match-min-score"`
+
+	// Folder rules
+	// FolderRuleSets are named sets of folder rules
+	FolderRuleSets map[string]*FolderRuleSet `json:"folder-rule-sets"`
+	// FolderRules maps a command name to the names of the rule sets it uses,
+	// commands that aren't in it use the ones under "default"
+	FolderRules map[string][]string `json:"folder-rules"`
+}
+
+// FolderPattern matches folders with either a glob or a regex
+type FolderPattern struct {
+	Glob  string `json:"glob"`
+	Regex string `json:"regex"`
+	// Match is what the pattern is checked against, either "basename" (the
+	// default) for the folder's name or "path" for its path relative to the
+	// root dir
+	Match string `json:"match"`
 }
 
-var configCache *Config
+// FolderRuleSet skips the folders matching any deny pattern, unless they
+// also match an allow pattern
+type FolderRuleSet struct {
+	Deny  []*FolderPattern `json:"deny"`
+	Allow []*FolderPattern `json:"allow"`
+}
+
+const (
+	// ProfileEnvVar is the environment variable used to pick a profile when
+	// there is no --profile flag
+	ProfileEnvVar = "PHOTOSYNC_PROFILE"
 
-// NewConfig gets a new Config
+	// DefaultProfile names the top level settings, unless there is a profile
+	// with that name
+	DefaultProfile = "default"
+
+	// DefaultFolderRules is the FolderRules key used by commands that don't
+	// have their own entry
+	DefaultFolderRules = "default"
+)
+
+var (
+	configFileLocation = "config/config.json"
+	configCache        = map[string]*Config{}
+)
+
+// SetConfigFileLocation changes which config file is read
+func SetConfigFileLocation(location string) {
+	configFileLocation = location
+	configCache = map[string]*Config{}
+}
+
+// profileTokenFileLocation gets the token file of a profile that doesn't set
+// one, next to the top level one with the profile's name added, e.g.
+// "config/token-other.json"
+func profileTokenFileLocation(topLevelTokenFileLocation, profile string) string {
+	if topLevelTokenFileLocation == "" {
+		topLevelTokenFileLocation = "config/token.json"
+	}
+	ext := filepath.Ext(topLevelTokenFileLocation)
+	return strings.TrimSuffix(topLevelTokenFileLocation, ext) + "-" + profile + ext
+}
+
+// NewConfig gets a new Config for the profile in the profile env var, if any
 func NewConfig() *Config {
-	if configCache == nil {
-		configCache = new(Config)
-		configFile, err := os.Open("config/config.json")
-		if err != nil {
-			log.Fatal(err)
+	return NewConfigForProfile(os.Getenv(ProfileEnvVar))
+}
+
+// NewConfigForProfile gets a new Config for the given profile. A profile's
+// settings override the top level settings, and the empty profile is just the
+// top level settings.
+func NewConfigForProfile(profile string) *Config {
+	if cfg, found := configCache[profile]; found {
+		return cfg
+	}
+
+	cfg := new(Config)
+	configFile, err := os.Open(configFileLocation)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer configFile.Close()
+	jsonParser := json.NewDecoder(configFile)
+	jsonParser.Decode(cfg)
+
+	if profile != "" {
+		profileJSON, found := cfg.Profiles[profile]
+		if !found && profile != DefaultProfile {
+			log.Fatalf("Profile '%s' not found in %s\n", profile, configFileLocation)
 		}
-		defer configFile.Close()
-		jsonParser := json.NewDecoder(configFile)
-		jsonParser.Decode(configCache)
-
-		// init channels
-		configCache.TokenDoneSignal = make(chan bool)
-
-		// Data Prepping
-		configCache.PicturePathRegexsToIgnore = []*regexp.Regexp{}
-		for _, regexToIgnore := range configCache.PicturePathSubstringsToIgnore {
-			configCache.PicturePathRegexsToIgnore = append(
-				configCache.PicturePathRegexsToIgnore,
-				regexp.MustCompile(regexToIgnore),
-			)
+		if found {
+			topLevelTokenFileLocation, topLevelCacheDir := cfg.TokenFileLocation, cfg.CacheDir
+			err := json.Unmarshal(profileJSON, cfg)
+			if err != nil {
+				log.Fatalf("Error reading profile '%s': %s\n", profile, err.Error())
+			}
+			// Each account needs its own token and cache, so a profile that
+			// doesn't set them gets its own rather than sharing the top level
+			// ones
+			profileSettings := map[string]json.RawMessage{}
+			json.Unmarshal(profileJSON, &profileSettings)
+			if _, set := profileSettings["token-file-location"]; !set {
+				cfg.TokenFileLocation = profileTokenFileLocation(topLevelTokenFileLocation, profile)
+			}
+			if _, set := profileSettings["cache-dir"]; !set {
+				if topLevelCacheDir == "" {
+					topLevelCacheDir = "cache"
+				}
+				cfg.CacheDir = filepath.Join(topLevelCacheDir, profile)
+			}
 		}
 	}
-	return configCache
+	cfg.Profile = profile
+
+	// Data Prepping
+	if cfg.DeviceAuthURL == "" {
+		cfg.DeviceAuthURL = "https://oauth2.googleapis.com/device/code"
+	}
+	if cfg.FullCacheSyncDays == 0 {
+		cfg.FullCacheSyncDays = 7
+	}
+	if cfg.ScanWorkers == 0 {
+		cfg.ScanWorkers = 8
+	}
+	if cfg.DownloadWorkers == 0 {
+		cfg.DownloadWorkers = 4
+	}
+	if cfg.CacheDir == "" {
+		cfg.CacheDir = "cache"
+	}
+
+	configCache[profile] = cfg
+	return cfg
 }
@@ -0,0 +1,291 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jastribl/photosync/files"
+	"github.com/jastribl/photosync/photos"
+)
+
+// DefaultLayout is the folder layout used when the config doesn't have one
+const DefaultLayout = "Google Photos/{year}/{month}"
+
+// Job is a media item to download to a path
+type Job struct {
+	MediaItem *photos.MediaItem
+	Path      string
+}
+
+// Result is how a job went
+type Result struct {
+	*Job
+	// Resumed is true when the download carried on from an earlier one that
+	// was interrupted
+	Resumed bool
+	// Hash is the hex SHA-256 hash of the downloaded file
+	Hash string
+	Err  error
+}
+
+// ExpandLayout gets the folder for a media item from a layout, replacing
+// {year}, {month} and {day} with the media item's creation date
+func ExpandLayout(layout string, mediaItem *photos.MediaItem) (string, error) {
+	creationTime, err := time.Parse(time.RFC3339, mediaItem.MediaMetadata.CreationTime)
+	if err != nil {
+		return "", fmt.Errorf("bad creation time for '%s': %s", mediaItem.Filename, err.Error())
+	}
+	folder := strings.NewReplacer(
+		"{year}", creationTime.Format("2006"),
+		"{month}", creationTime.Format("01"),
+		"{day}", creationTime.Format("02"),
+	).Replace(layout)
+	return filepath.FromSlash(folder), nil
+}
+
+// Planner picks the paths that media items get downloaded to, making sure two
+// media items never get the same path and that nothing already there gets
+// overwritten
+type Planner struct {
+	taken map[string]bool
+}
+
+// NewIDSuffixPlanner gets a new Planner that adds "-" and the end of the media
+// item's ID before the extension when a filename is taken, so the path a media
+// item gets doesn't depend on the order media items are planned in
+func NewIDSuffixPlanner() *Planner {
+	return &Planner{taken: map[string]bool{}}
+}
+
+// Reserve stops the path from being given to any media item
+func (p *Planner) Reserve(path string) {
+	p.taken[path] = true
+}
+
+// idSuffixLength is how much of the end of a media item's ID is used to tell
+// apart media items with the same filename
+const idSuffixLength = 8
+
+// Plan gets the job for downloading the media item into the dir, using the
+// media item's filename unless that is taken or there is already a file with
+// it.
+func (p *Planner) Plan(mediaItem *photos.MediaItem, dir string) *Job {
+	ext := filepath.Ext(mediaItem.Filename)
+	stem := strings.TrimSuffix(mediaItem.Filename, ext)
+	path := filepath.Join(dir, mediaItem.Filename)
+	for i := 1; p.taken[path] || fileExists(path); i++ {
+		idSuffix := mediaItem.ID
+		if len(idSuffix) > idSuffixLength {
+			idSuffix = idSuffix[len(idSuffix)-idSuffixLength:]
+		}
+		if i > 1 {
+			idSuffix = fmt.Sprintf("%s-%d", idSuffix, i)
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%s%s", stem, idSuffix, ext))
+	}
+	p.taken[path] = true
+	return &Job{MediaItem: mediaItem, Path: path}
+}
+
+// partialPath gets the path of the partial file a media item is downloaded to
+// before being renamed to the path
+func partialPath(path string, mediaItem *photos.MediaItem) string {
+	return path + "." + mediaItem.ID + files.PartialDownloadSuffix
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// Run downloads the jobs with the given number of workers, calling onResult
+// with each result from a single goroutine. It stops early with the context's
+// error when the context is done, leaving unfinished downloads to be resumed.
+func Run(
+	ctx context.Context,
+	client *photos.Client,
+	jobs []*Job,
+	workers int,
+	onResult func(*Result),
+) error {
+	if workers < 1 {
+		workers = 1
+	}
+	jobQueue := make(chan *Job)
+	results := make(chan *Result)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobQueue {
+				resumed, hash, err := File(ctx, client, job.MediaItem, job.Path)
+				results <- &Result{Job: job, Resumed: resumed, Hash: hash, Err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobQueue)
+		for _, job := range jobs {
+			select {
+			case jobQueue <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		if result.Err != nil && ctx.Err() != nil {
+			// interrupted, so the download will resume next time
+			continue
+		}
+		onResult(result)
+	}
+	return ctx.Err()
+}
+
+// File downloads a media item to the path, going through a partial file so an
+// interrupted download can be resumed, and sets the file's modification time
+// to the media item's creation time. The partial file is named after the
+// media item's ID, so a download never resumes from another media item's bytes
+// that were planned to the same path by an earlier run. It returns if the download was resumed
+// and the hex SHA-256 hash of the file.
+func File(
+	ctx context.Context,
+	client *photos.Client,
+	mediaItem *photos.MediaItem,
+	path string,
+) (bool, string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return false, "", err
+	}
+	partPath := partialPath(path, mediaItem)
+	offset := int64(0)
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	body, resumed, err := client.DownloadMediaItemFrom(ctx, mediaItem, offset)
+	if err != nil {
+		return false, "", err
+	}
+	defer body.Close()
+
+	hasher := sha256.New()
+	flags := os.O_CREATE | os.O_RDWR | os.O_TRUNC
+	if resumed {
+		flags = os.O_CREATE | os.O_RDWR
+	}
+	partFile, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return false, "", err
+	}
+	if resumed {
+		// hash what was already downloaded, which leaves the file at its end
+		// ready for the rest
+		_, err = io.Copy(hasher, partFile)
+	}
+	if err == nil {
+		_, err = io.Copy(io.MultiWriter(partFile, hasher), body)
+	}
+	if closeErr := partFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	if err := os.Rename(partPath, path); err != nil {
+		return false, "", err
+	}
+	if creationTime, err := time.Parse(time.RFC3339, mediaItem.MediaMetadata.CreationTime); err == nil {
+		if err := os.Chtimes(path, creationTime, creationTime); err != nil {
+			return false, "", err
+		}
+	}
+	return resumed, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Record is a log of the media items that have been downloaded, so they aren't
+// downloaded again when they don't show up as matching a local file
+type Record struct {
+	path             string
+	pathsByMediaItem map[string]string
+}
+
+type recordEntry struct {
+	DownloadedAt string `json:"downloadedAt"`
+	MediaItemID  string `json:"mediaItemId"`
+	Filename     string `json:"filename"`
+	Path         string `json:"path"`
+}
+
+// OpenRecord reads the record at the path, which doesn't need to exist yet
+func OpenRecord(path string) (*Record, error) {
+	r := &Record{path: path, pathsByMediaItem: map[string]string{}}
+	recordFile, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer recordFile.Close()
+	decoder := json.NewDecoder(recordFile)
+	for {
+		entry := &recordEntry{}
+		err := decoder.Decode(entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %s", path, err.Error())
+		}
+		r.pathsByMediaItem[entry.MediaItemID] = entry.Path
+	}
+	return r, nil
+}
+
+// Downloaded gets where the media item was downloaded to, if it was and the
+// file is still there
+func (r *Record) Downloaded(mediaItemID string) (string, bool) {
+	path, found := r.pathsByMediaItem[mediaItemID]
+	if !found || !fileExists(path) {
+		return "", false
+	}
+	return path, true
+}
+
+// Add appends a finished download to the record
+func (r *Record) Add(job *Job) error {
+	recordFile, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer recordFile.Close()
+	err = json.NewEncoder(recordFile).Encode(recordEntry{
+		DownloadedAt: time.Now().Format(time.RFC3339),
+		MediaItemID:  job.MediaItem.ID,
+		Filename:     job.MediaItem.Filename,
+		Path:         job.Path,
+	})
+	if err != nil {
+		return err
+	}
+	r.pathsByMediaItem[job.MediaItem.ID] = job.Path
+	return nil
+}
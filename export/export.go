@@ -0,0 +1,386 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jastribl/photosync/files"
+	"github.com/jastribl/photosync/labelling"
+	"github.com/jastribl/photosync/photos"
+)
+
+const (
+	// MarkdownSidecarFilename is the name of the Markdown sidecar in an
+	// exported album's folder
+	MarkdownSidecarFilename = "album.md"
+	// JSONSidecarFilename is the name of the JSON sidecar in an exported
+	// album's folder
+	JSONSidecarFilename = "album.json"
+)
+
+// movingPrefix is the prefix of the temporary names files are moved to while
+// they are renamed to their new positions, so files swapping positions don't
+// overwrite each other
+const movingPrefix = ".photosync-moving-"
+
+// movesJournalFilename is where the moves being done are written first, so an
+// interrupted MoveFiles can be rolled back or finished by the next one
+const movesJournalFilename = ".photosync-moves.json"
+
+// idSuffixLength is how much of the end of an album's ID is used to tell apart
+// albums with the same title
+const idSuffixLength = 8
+
+// minPrefixWidth is the fewest digits used for the position prefix of
+// exported files, so small albums still sort the same way as big ones
+const minPrefixWidth = 3
+
+const (
+	// ItemMediaItem is a media item of an album
+	ItemMediaItem = "mediaItem"
+	// ItemText is a text label of an album
+	ItemText = "text"
+)
+
+// Item is a media item or a text label in an exported album, in album order
+type Item struct {
+	// Type is ItemMediaItem or ItemText
+	Type        string `json:"type"`
+	MediaItemID string `json:"mediaItemId,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	// Path is where the media item is exported to, relative to the album's
+	// folder
+	Path    string `json:"path,omitempty"`
+	IsVideo bool   `json:"isVideo,omitempty"`
+	Text    string `json:"text,omitempty"`
+
+	mediaItem *photos.MediaItem
+}
+
+// Album is an album exported to a folder
+type Album struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	URL        string  `json:"url"`
+	ExportedAt string  `json:"exportedAt"`
+	Items      []*Item `json:"items"`
+}
+
+// NewAlbum lays out an album's media items in album order, with a numeric
+// prefix on each filename so the files sort the same way, and the labels
+// placed right after the media items (or labels) they follow in the album
+func NewAlbum(album *photos.Album, mediaItems []*photos.MediaItem, labels []*labelling.Label) *Album {
+	// labels are in parent first order, so labels going after another label
+	// end up right after it
+	labelsAfter := map[string][]string{}
+	for _, label := range labels {
+		anchor := label
+		for anchor.AfterLabel != nil {
+			anchor = anchor.AfterLabel
+		}
+		afterID := ""
+		if anchor.AfterMediaItem != nil {
+			afterID = anchor.AfterMediaItem.ID
+		}
+		labelsAfter[afterID] = append(labelsAfter[afterID], label.Text)
+	}
+
+	exported := &Album{
+		ID:         album.ID,
+		Title:      album.Title,
+		URL:        album.ProductULR,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Items:      []*Item{},
+	}
+	addLabels := func(afterID string) {
+		for _, text := range labelsAfter[afterID] {
+			exported.Items = append(exported.Items, &Item{Type: ItemText, Text: text})
+		}
+	}
+
+	addLabels("")
+	width := len(strconv.Itoa(len(mediaItems)))
+	if width < minPrefixWidth {
+		width = minPrefixWidth
+	}
+	for i, mediaItem := range mediaItems {
+		exported.Items = append(exported.Items, &Item{
+			Type:        ItemMediaItem,
+			MediaItemID: mediaItem.ID,
+			Filename:    mediaItem.Filename,
+			Path:        fmt.Sprintf("%0*d-%s", width, i+1, SafeName(mediaItem.Filename)),
+			IsVideo:     mediaItem.MediaMetadata.Video != nil,
+			mediaItem:   mediaItem,
+		})
+		addLabels(mediaItem.ID)
+	}
+	return exported
+}
+
+// MediaItem gets the media item of an ItemMediaItem item
+func (i *Item) MediaItem() *photos.MediaItem {
+	return i.mediaItem
+}
+
+// SafeName makes an album title or filename safe to use as a single file or
+// folder name
+func SafeName(name string) string {
+	name = strings.TrimSpace(strings.NewReplacer("/", "-", "\\", "-", "\x00", "").Replace(name))
+	if name == "" || name == "." || name == ".." {
+		return "Untitled"
+	}
+	return name
+}
+
+// FolderName gets the name of an album's folder in the export dir. That is its
+// title, unless another album's export is already there or, when titleShared,
+// the folder isn't already this album's. Then the end of the album's ID is
+// added, so albums sharing a title keep their folders whichever order they
+// are listed in.
+func FolderName(exportDir string, album *photos.Album, titleShared bool) (string, error) {
+	name := SafeName(album.Title)
+	existing, err := LoadAlbum(filepath.Join(exportDir, name))
+	if err != nil {
+		return "", err
+	}
+	if existing != nil && existing.ID == album.ID {
+		return name, nil
+	}
+	if existing == nil && !titleShared {
+		return name, nil
+	}
+	idSuffix := album.ID
+	if len(idSuffix) > idSuffixLength {
+		idSuffix = idSuffix[len(idSuffix)-idSuffixLength:]
+	}
+	return fmt.Sprintf("%s - %s", name, idSuffix), nil
+}
+
+// WriteMarkdown writes the album as Markdown into its folder, with each label
+// as a paragraph and each media item as an image (or a link for videos)
+func (a *Album) WriteMarkdown(dir string) (string, error) {
+	var md strings.Builder
+	fmt.Fprintf(&md, "# %s\n\n", a.Title)
+	if a.URL != "" {
+		fmt.Fprintf(&md, "[Open in Google Photos](%s)\n\n", a.URL)
+	}
+	for _, item := range a.Items {
+		switch {
+		case item.Type == ItemText:
+			fmt.Fprintf(&md, "%s\n\n", item.Text)
+		case item.IsVideo:
+			fmt.Fprintf(&md, "[%s](<%s>)\n\n", item.Filename, item.Path)
+		default:
+			fmt.Fprintf(&md, "![%s](<%s>)\n\n", item.Filename, item.Path)
+		}
+	}
+	path := filepath.Join(dir, MarkdownSidecarFilename)
+	return path, ioutil.WriteFile(path, []byte(md.String()), 0644)
+}
+
+// WriteJSON writes the album as JSON into its folder
+func (a *Album) WriteJSON(dir string) (string, error) {
+	albumJSON, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, JSONSidecarFilename)
+	return path, ioutil.WriteFile(path, albumJSON, 0644)
+}
+
+// LoadAlbum reads the JSON sidecar of an album exported before, or nil if the
+// folder doesn't have one
+func LoadAlbum(dir string) (*Album, error) {
+	albumJSON, err := ioutil.ReadFile(filepath.Join(dir, JSONSidecarFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	album := &Album{}
+	if err := json.Unmarshal(albumJSON, album); err != nil {
+		return nil, fmt.Errorf("error reading '%s': %s", filepath.Join(dir, JSONSidecarFilename), err.Error())
+	}
+	return album, nil
+}
+
+// Move is a file of a media item moved to the media item's new position
+type Move struct {
+	MediaItemID string `json:"mediaItemId"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+}
+
+// movesJournal is the moves MoveFiles is doing, Renamed being true once every
+// file has its temporary name
+type movesJournal struct {
+	Renamed bool    `json:"renamed"`
+	Moves   []*Move `json:"moves"`
+}
+
+func movingPath(dir string, i int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%d", movingPrefix, i))
+}
+
+func writeMovesJournal(dir string, journal *movesJournal) error {
+	journalJSON, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	// written next to it and renamed over it so it is never half written
+	path := filepath.Join(dir, movesJournalFilename)
+	if err := ioutil.WriteFile(path+".new", journalJSON, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".new", path)
+}
+
+// recoverMoves rolls back the moves of an interrupted MoveFiles that hadn't
+// given every file its temporary name yet, or otherwise finishes them and
+// updates the previous export's paths to match
+func recoverMoves(dir string, previous *Album) error {
+	path := filepath.Join(dir, movesJournalFilename)
+	journalJSON, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	journal := &movesJournal{}
+	if err := json.Unmarshal(journalJSON, journal); err != nil {
+		return fmt.Errorf("error reading '%s': %s", path, err.Error())
+	}
+
+	for i, move := range journal.Moves {
+		if !files.FileExists(movingPath(dir, i)) {
+			continue
+		}
+		target := move.From
+		if journal.Renamed {
+			target = move.To
+		}
+		if err := os.Rename(movingPath(dir, i), filepath.Join(dir, target)); err != nil {
+			return err
+		}
+	}
+	if journal.Renamed && previous != nil {
+		for _, move := range journal.Moves {
+			if item := previous.mediaItemItem(move.MediaItemID); item != nil {
+				item.Path = move.To
+			}
+		}
+	}
+	return os.Remove(path)
+}
+
+// MoveResult is what MoveFiles did with the files exported before
+type MoveResult struct {
+	Moved []*Move
+	// Stale are the paths of files whose media items aren't in the album
+	// any more
+	Stale []string
+	// Conflicts are the moves that couldn't be done because another file is
+	// already at the new position. Those media items keep their old path.
+	Conflicts []*Move
+}
+
+// MoveFiles renames the files of media items exported before, found by media
+// item ID in the previous export, to their positions in this export. Files of
+// media items no longer in the album are left where they are and returned as
+// stale, and files whose new position is taken by another file keep their old
+// path. The moves are journaled first, so if they are interrupted the next
+// MoveFiles rolls them back or finishes them before working out its own.
+func (a *Album) MoveFiles(dir string, previous *Album) (*MoveResult, error) {
+	result := &MoveResult{}
+	if err := recoverMoves(dir, previous); err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return result, nil
+	}
+	previousPaths := map[string]string{}
+	for _, item := range previous.Items {
+		if item.Type == ItemMediaItem && item.Path != "" {
+			previousPaths[item.MediaItemID] = item.Path
+		}
+	}
+
+	inAlbum := map[string]bool{}
+	moving := map[string]bool{}
+	for _, item := range a.Items {
+		if item.Type != ItemMediaItem {
+			continue
+		}
+		inAlbum[item.MediaItemID] = true
+		from, ok := previousPaths[item.MediaItemID]
+		if !ok || from == item.Path || !files.FileExists(filepath.Join(dir, from)) {
+			continue
+		}
+		result.Moved = append(result.Moved, &Move{MediaItemID: item.MediaItemID, From: from, To: item.Path})
+		moving[from] = true
+	}
+	for _, item := range previous.Items {
+		if item.Type == ItemMediaItem && item.Path != "" && !inAlbum[item.MediaItemID] && files.FileExists(filepath.Join(dir, item.Path)) {
+			result.Stale = append(result.Stale, item.Path)
+		}
+	}
+
+	// a new position taken by a file that isn't moving away can't be used,
+	// which keeps that file where it is and so can block other moves too
+	for conflicted := true; conflicted; {
+		conflicted = false
+		moves := []*Move{}
+		for _, move := range result.Moved {
+			if files.FileExists(filepath.Join(dir, move.To)) && !moving[move.To] {
+				delete(moving, move.From)
+				a.mediaItemItem(move.MediaItemID).Path = move.From
+				result.Conflicts = append(result.Conflicts, move)
+				conflicted = true
+				continue
+			}
+			moves = append(moves, move)
+		}
+		result.Moved = moves
+	}
+
+	if len(result.Moved) == 0 {
+		return result, nil
+	}
+
+	journal := &movesJournal{Moves: result.Moved}
+	if err := writeMovesJournal(dir, journal); err != nil {
+		return nil, err
+	}
+	for i, move := range journal.Moves {
+		if err := os.Rename(filepath.Join(dir, move.From), movingPath(dir, i)); err != nil {
+			return nil, err
+		}
+	}
+	journal.Renamed = true
+	if err := writeMovesJournal(dir, journal); err != nil {
+		return nil, err
+	}
+	for i, move := range journal.Moves {
+		if err := os.Rename(movingPath(dir, i), filepath.Join(dir, move.To)); err != nil {
+			return nil, err
+		}
+	}
+	return result, os.Remove(filepath.Join(dir, movesJournalFilename))
+}
+
+func (a *Album) mediaItemItem(mediaItemID string) *Item {
+	for _, item := range a.Items {
+		if item.Type == ItemMediaItem && item.MediaItemID == mediaItemID {
+			return item
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package files
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// AssetKind is what kind of files make up an asset
+type AssetKind string
+
+const (
+	// AssetSingle is a single file
+	AssetSingle AssetKind = "single"
+	// AssetLivePhoto is the photo and video of a Live Photo
+	AssetLivePhoto AssetKind = "live-photo"
+	// AssetRawJPEG is a RAW file and the JPEG (or HEIC) the camera saved with it
+	AssetRawJPEG AssetKind = "raw+jpeg"
+	// AssetBurst is the photos of a burst
+	AssetBurst AssetKind = "burst"
+)
+
+// Asset is one logical photo or video, which can be made up of several local
+// files that Google Photos shows as a single media item
+type Asset struct {
+	Kind AssetKind
+	// Primary is the file that the media item is expected to match
+	Primary *LocalFile
+	// Files are all the files of the asset, including the primary one
+	Files []*LocalFile
+}
+
+var (
+	// assetPhotoExts are the extensions that can be the primary file of a Live
+	// Photo or RAW+JPEG pair
+	assetPhotoExts = map[string]bool{".heic": true, ".jpg": true, ".jpeg": true}
+	// livePhotoVideoExts are the extensions of the video of a Live Photo
+	livePhotoVideoExts = map[string]bool{".mov": true, ".mp4": true}
+	rawExts            = map[string]bool{
+		".dng": true, ".cr2": true, ".cr3": true, ".nef": true, ".arw": true,
+		".raf": true, ".orf": true, ".rw2": true, ".pef": true, ".srw": true,
+	}
+	// sidecarExts are edit and metadata files saved next to photos, which are
+	// never uploaded on their own
+	sidecarExts = map[string]bool{".aae": true, ".xmp": true}
+
+	// burstRegexs match the names (without extension) of the photos of a
+	// burst, with the first group identifying the burst. Names with "COVER" in
+	// them are the photo shown for the burst.
+	burstRegexs = []*regexp.Regexp{
+		// e.g. 00001IMG_00001_BURST20210605140302.jpg
+		regexp.MustCompile(`(?i)^\d+IMG_\d+_(BURST\d{14})(_COVER)?$`),
+		// e.g. IMG_20210605_140302_BURST001_COVER.jpg
+		regexp.MustCompile(`(?i)^(.+_BURST)\d+(_COVER)?$`),
+	}
+)
+
+// GroupAssets groups the local files into assets and sets each file's Asset.
+// Files in the same dir with the same name apart from the extension are a Live
+// Photo if there is a photo and a video, or a RAW+JPEG pair if there is a
+// photo and a RAW file, and any sidecar files go with them. Photos in the same
+// dir with names from the same burst are grouped too. Every other file is an
+// asset on its own. The assets are in the order of their primary files.
+func GroupAssets(localFiles []*LocalFile) []*Asset {
+	stemGroups := map[string][]*LocalFile{}
+	stemKeys := []string{}
+	for _, localFile := range localFiles {
+		key := strings.ToLower(strings.TrimSuffix(localFile.RelPath, path.Ext(localFile.RelPath)))
+		if _, found := stemGroups[key]; !found {
+			stemKeys = append(stemKeys, key)
+		}
+		stemGroups[key] = append(stemGroups[key], localFile)
+	}
+
+	assets := []*Asset{}
+	for _, key := range stemKeys {
+		group := stemGroups[key]
+		if asset := pairAsset(group); asset != nil {
+			assets = append(assets, asset)
+			continue
+		}
+		for _, localFile := range group {
+			assets = append(assets, &Asset{Kind: AssetSingle, Primary: localFile, Files: []*LocalFile{localFile}})
+		}
+	}
+
+	assets = groupBursts(assets)
+	for _, asset := range assets {
+		for _, localFile := range asset.Files {
+			localFile.Asset = asset
+		}
+	}
+	return assets
+}
+
+// pairAsset makes a Live Photo or RAW+JPEG asset out of files with the same
+// name apart from the extension, or returns nil if they aren't one
+func pairAsset(group []*LocalFile) *Asset {
+	if len(group) < 2 {
+		return nil
+	}
+	var primary *LocalFile
+	hasVideo, hasRaw := false, false
+	for _, localFile := range group {
+		switch {
+		case assetPhotoExts[localFile.Ext]:
+			// prefer a JPEG over a HEIC, which is what gets uploaded when both
+			// are there
+			if primary == nil || (primary.Ext == ".heic" && localFile.Ext != ".heic") {
+				primary = localFile
+			}
+		case livePhotoVideoExts[localFile.Ext]:
+			hasVideo = true
+		case rawExts[localFile.Ext]:
+			hasRaw = true
+		case sidecarExts[localFile.Ext]:
+		default:
+			// something else with the same name, so not a pair
+			return nil
+		}
+	}
+	if primary == nil || (!hasVideo && !hasRaw) {
+		return nil
+	}
+
+	asset := &Asset{Kind: AssetRawJPEG, Primary: primary, Files: group}
+	if hasVideo {
+		asset.Kind = AssetLivePhoto
+	}
+	return asset
+}
+
+// groupBursts merges the single photo assets that are from the same burst
+func groupBursts(assets []*Asset) []*Asset {
+	bursts := map[string]*Asset{}
+	grouped := []*Asset{}
+	for _, asset := range assets {
+		burstKey, isCover := burstKeyOf(asset)
+		if burstKey == "" {
+			grouped = append(grouped, asset)
+			continue
+		}
+		burst, found := bursts[burstKey]
+		if !found {
+			burst = &Asset{Kind: AssetBurst, Primary: asset.Primary, Files: []*LocalFile{}}
+			bursts[burstKey] = burst
+			grouped = append(grouped, burst)
+		}
+		if isCover {
+			burst.Primary = asset.Primary
+		}
+		burst.Files = append(burst.Files, asset.Files...)
+	}
+
+	// a burst of one photo is just a photo
+	for _, asset := range grouped {
+		if asset.Kind == AssetBurst && len(asset.Files) == 1 {
+			asset.Kind = AssetSingle
+		}
+	}
+	return grouped
+}
+
+// burstKeyOf gets the dir and burst of a single photo asset, or "" if it
+// isn't from a burst, and whether it is the burst's cover photo
+func burstKeyOf(asset *Asset) (string, bool) {
+	if asset.Kind != AssetSingle || !assetPhotoExts[asset.Primary.Ext] {
+		return "", false
+	}
+	relPath := asset.Primary.RelPath
+	stem := strings.TrimSuffix(path.Base(relPath), path.Ext(relPath))
+	for _, burstRegex := range burstRegexs {
+		if parts := burstRegex.FindStringSubmatch(stem); parts != nil {
+			return strings.ToLower(path.Dir(relPath) + "/" + parts[1]), parts[2] != ""
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,148 @@
+package files
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// DefaultExtensionGroups are the extension groups used when the config
+	// doesn't have any
+	DefaultExtensionGroups = [][]string{
+		{"heic", "jpg", "jpeg"},
+		{"mov", "mp4"},
+	}
+	// DefaultFilenameSuffixes are the filename suffixes used when the config
+	// doesn't have any
+	DefaultFilenameSuffixes = []string{"-edited", "_hdr"}
+)
+
+// duplicateSuffixRegex matches the " (1)" or "(1)" that Google Photos and
+// file managers add to the end of duplicate filenames
+var duplicateSuffixRegex = regexp.MustCompile(`\s*\(\d+\)$`)
+
+// FilenameComparison is how alike two filenames are, from least to most
+type FilenameComparison int
+
+const (
+	// DifferentFilenames have different stems
+	DifferentFilenames FilenameComparison = iota
+	// SameStemFilenames only differ by extensions that aren't equivalent, like
+	// the photo and video of a Live Photo
+	SameStemFilenames
+	// SuffixEquivalentFilenames are equivalent once suffixes like "-edited"
+	// are removed
+	SuffixEquivalentFilenames
+	// EquivalentFilenames are the same apart from duplicate suffixes like "(1)"
+	// and equivalent extensions
+	EquivalentFilenames
+	// SameFilenames are the same ignoring case
+	SameFilenames
+)
+
+// FilenameEquivalence decides which filenames are the same picture. Only the
+// extension and the end of the name are ever changed, so ".jpg" in the middle
+// of a filename is left alone.
+type FilenameEquivalence struct {
+	// extensionGroups are lowercase and without a dot
+	extensionGroups [][]string
+	// suffixes are lowercase
+	suffixes []string
+}
+
+// NewFilenameEquivalence gets a FilenameEquivalence where two extensions are
+// equivalent when they are in the same group, and the suffixes are removed
+// from the end of filenames before comparing them. Extensions can be given
+// with or without a dot, and case is ignored.
+func NewFilenameEquivalence(extensionGroups [][]string, suffixes []string) *FilenameEquivalence {
+	e := &FilenameEquivalence{
+		extensionGroups: [][]string{},
+		suffixes:        []string{},
+	}
+	for _, group := range extensionGroups {
+		lowercaseGroup := []string{}
+		for _, ext := range group {
+			lowercaseGroup = append(lowercaseGroup, strings.TrimPrefix(strings.ToLower(ext), "."))
+		}
+		e.extensionGroups = append(e.extensionGroups, lowercaseGroup)
+	}
+	for _, suffix := range suffixes {
+		if suffix != "" {
+			e.suffixes = append(e.suffixes, strings.ToLower(suffix))
+		}
+	}
+	return e
+}
+
+// split gets the lowercase filename's stem without any duplicate suffix, the
+// stem without any other suffixes either, and the extension without a dot
+func (e *FilenameEquivalence) split(filename string) (string, string, string) {
+	lowercaseFilename := strings.ToLower(filename)
+	ext := filepath.Ext(lowercaseFilename)
+	stem := duplicateSuffixRegex.ReplaceAllString(strings.TrimSuffix(lowercaseFilename, ext), "")
+
+	bareStem := stem
+	for removed := true; removed; {
+		removed = false
+		for _, suffix := range e.suffixes {
+			if len(bareStem) > len(suffix) && strings.HasSuffix(bareStem, suffix) {
+				bareStem = duplicateSuffixRegex.ReplaceAllString(strings.TrimSuffix(bareStem, suffix), "")
+				removed = true
+			}
+		}
+	}
+	return stem, bareStem, strings.TrimPrefix(ext, ".")
+}
+
+// Stem gets the lowercase filename without its extension, a duplicate suffix
+// or any of the suffixes, which is the same for all filenames that are at
+// least SameStemFilenames
+func (e *FilenameEquivalence) Stem(filename string) string {
+	_, bareStem, _ := e.split(filename)
+	return bareStem
+}
+
+// EquivalentExtensions returns if the lowercase extensions, without a dot, are
+// the same or in the same group
+func (e *FilenameEquivalence) EquivalentExtensions(ext1, ext2 string) bool {
+	if ext1 == ext2 {
+		return true
+	}
+	for _, group := range e.extensionGroups {
+		has1, has2 := false, false
+		for _, ext := range group {
+			has1 = has1 || ext == ext1
+			has2 = has2 || ext == ext2
+		}
+		if has1 && has2 {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare compares two filenames
+func (e *FilenameEquivalence) Compare(filename1, filename2 string) FilenameComparison {
+	if strings.EqualFold(filename1, filename2) {
+		return SameFilenames
+	}
+	stem1, bareStem1, ext1 := e.split(filename1)
+	stem2, bareStem2, ext2 := e.split(filename2)
+	switch {
+	case bareStem1 != bareStem2:
+		return DifferentFilenames
+	case !e.EquivalentExtensions(ext1, ext2):
+		return SameStemFilenames
+	case stem1 != stem2:
+		return SuffixEquivalentFilenames
+	default:
+		return EquivalentFilenames
+	}
+}
+
+// Equivalent returns if the filenames are the same picture, allowing for
+// suffixes
+func (e *FilenameEquivalence) Equivalent(filename1, filename2 string) bool {
+	return e.Compare(filename1, filename2) >= SuffixEquivalentFilenames
+}
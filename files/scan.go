@@ -0,0 +1,347 @@
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jastribl/photosync/rules"
+)
+
+// LocalFile is a file found when scanning a local dir
+type LocalFile struct {
+	// Path is the path of the file, starting with the scanned dir
+	Path string
+	// RelPath is the path of the file relative to the scanned dir, using
+	// forward slashes
+	RelPath string
+	Size    int64
+	ModTime time.Time
+	// Ext is the lowercase extension, including the dot
+	Ext string
+	// Asset is the asset the file is part of
+	Asset *Asset
+
+	// hash is the file's hash once it has been worked out
+	hash string
+}
+
+func newLocalFile(rootDir, relPath string, info os.FileInfo) *LocalFile {
+	return &LocalFile{
+		Path:    filepath.Join(rootDir, filepath.FromSlash(relPath)),
+		RelPath: relPath,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Ext:     strings.ToLower(filepath.Ext(info.Name())),
+	}
+}
+
+// Name gets the file's name
+func (f *LocalFile) Name() string {
+	return path.Base(f.RelPath)
+}
+
+// LowercaseName gets the file's name in lowercase, which is what gets matched
+// against media item filenames
+func (f *LocalFile) LowercaseName() string {
+	return strings.ToLower(f.Name())
+}
+
+// Hash gets the hex SHA-256 hash of the file's bytes, only reading the file
+// the first time
+func (f *LocalFile) Hash() (string, error) {
+	if f.hash != "" {
+		return f.hash, nil
+	}
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	f.hash = hex.EncodeToString(hasher.Sum(nil))
+	return f.hash, nil
+}
+
+// PhotosyncFilePrefix starts the names of the files photosync keeps next to
+// pictures, like ignore files and backup manifests
+const PhotosyncFilePrefix = ".photosync"
+
+// PartialDownloadSuffix ends the names of files that are still being
+// downloaded
+const PartialDownloadSuffix = ".photosync-part"
+
+// isSkippedFile returns if a file is never a picture, so is left out of scans
+func isSkippedFile(name string) bool {
+	return name == ".DS_Store" ||
+		strings.HasPrefix(name, PhotosyncFilePrefix) ||
+		strings.HasSuffix(name, PartialDownloadSuffix)
+}
+
+// ScanOptions are the options for scanning a dir
+type ScanOptions struct {
+	// FolderRules say which folders to skip, on top of the ignore files
+	FolderRules *rules.FolderRules
+	// FollowSymlinks makes symlinked dirs get scanned as well, otherwise they
+	// are skipped. Symlinked files are always included.
+	FollowSymlinks bool
+	// Workers is how many dirs get read at once, 1 if not set
+	Workers int
+}
+
+// ScanError is an error with a single file or dir found while scanning, which
+// doesn't stop the rest of the scan
+type ScanError struct {
+	Path string
+	Err  error
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err.Error())
+}
+
+// ScanResult is what a scan found, sorted by path
+type ScanResult struct {
+	Files []*LocalFile
+	// Assets are the files grouped into assets, see GroupAssets
+	Assets []*Asset
+	Errors []*ScanError
+}
+
+// scanDir is a dir waiting to be scanned
+type scanDir struct {
+	// relDir is the dir path relative to the root dir, empty for the root
+	relDir string
+	// realPath is the dir's path with all symlinks resolved, only set when
+	// following symlinks
+	realPath    string
+	ignoreFiles rules.IgnoreFiles
+}
+
+type scanner struct {
+	ctx     context.Context
+	rootDir string
+	options *ScanOptions
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// queue holds the dirs waiting for a worker, pending also counts the ones
+	// being scanned, so the scan is done when it gets to 0
+	queue   []*scanDir
+	pending int
+	// visitedRealPaths are the dirs scanned so far, only used when following
+	// symlinks to not scan a dir twice
+	visitedRealPaths map[string]bool
+	result           *ScanResult
+}
+
+// ScanDir finds all the files under rootDir, skipping the files and folders
+// that the folder rules or the ignore files say to. Dirs are read by a pool of
+// workers. Files and dirs that can't be read are returned as errors rather
+// than stopping the scan, and the scan stops early with the context's error if
+// the context is done.
+func ScanDir(ctx context.Context, rootDir string, options *ScanOptions) (*ScanResult, error) {
+	if options == nil {
+		options = &ScanOptions{}
+	}
+	s := &scanner{
+		ctx:              ctx,
+		rootDir:          rootDir,
+		options:          options,
+		visitedRealPaths: map[string]bool{},
+		result:           &ScanResult{},
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	root := &scanDir{}
+	if options.FollowSymlinks {
+		realPath, err := filepath.EvalSymlinks(rootDir)
+		if err != nil {
+			return nil, err
+		}
+		root.realPath = realPath
+		s.visitedRealPaths[realPath] = true
+	}
+	s.queue = []*scanDir{root}
+	s.pending = 1
+
+	// wake up the waiting workers when the context is done
+	scanDone := make(chan struct{})
+	defer close(scanDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		case <-scanDone:
+		}
+	}()
+
+	workers := options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work()
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(s.result.Files, func(i, j int) bool {
+		return s.result.Files[i].RelPath < s.result.Files[j].RelPath
+	})
+	sort.Slice(s.result.Errors, func(i, j int) bool {
+		return s.result.Errors[i].Path < s.result.Errors[j].Path
+	})
+	s.result.Assets = GroupAssets(s.result.Files)
+	return s.result, nil
+}
+
+func (s *scanner) work() {
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && s.pending > 0 && s.ctx.Err() == nil {
+			s.cond.Wait()
+		}
+		if s.pending == 0 || s.ctx.Err() != nil {
+			s.mu.Unlock()
+			return
+		}
+		dir := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		childDirs, localFiles, scanErrors := s.scan(dir)
+
+		s.mu.Lock()
+		s.result.Files = append(s.result.Files, localFiles...)
+		s.result.Errors = append(s.result.Errors, scanErrors...)
+		s.queue = append(s.queue, childDirs...)
+		s.pending += len(childDirs) - 1
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+// scan reads a single dir, returning the dirs under it to scan next
+func (s *scanner) scan(dir *scanDir) ([]*scanDir, []*LocalFile, []*ScanError) {
+	childDirs := []*scanDir{}
+	localFiles := []*LocalFile{}
+	scanErrors := []*ScanError{}
+	dirPath := filepath.Join(s.rootDir, filepath.FromSlash(dir.relDir))
+
+	ignoreFile, err := rules.LoadIgnoreFile(s.rootDir, dir.relDir)
+	if err != nil {
+		// without its ignore file it isn't known what to skip, so skip it all
+		scanErrors = append(scanErrors, &ScanError{Path: filepath.Join(dirPath, rules.IgnoreFilename), Err: err})
+		return childDirs, localFiles, scanErrors
+	}
+	ignoreFiles := dir.ignoreFiles.With(ignoreFile)
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		scanErrors = append(scanErrors, &ScanError{Path: dirPath, Err: err})
+		return childDirs, localFiles, scanErrors
+	}
+	for _, entry := range entries {
+		if s.ctx.Err() != nil {
+			break
+		}
+		if isSkippedFile(entry.Name()) {
+			continue
+		}
+		relPath := path.Join(dir.relDir, entry.Name())
+		entryPath := filepath.Join(dirPath, entry.Name())
+
+		var info os.FileInfo
+		isSymlink := entry.Type()&os.ModeSymlink != 0
+		if isSymlink {
+			// use what the symlink points to
+			info, err = os.Stat(entryPath)
+		} else {
+			info, err = entry.Info()
+		}
+		if err != nil {
+			scanErrors = append(scanErrors, &ScanError{Path: entryPath, Err: err})
+			continue
+		}
+		if isSymlink && info.IsDir() && !s.options.FollowSymlinks {
+			continue
+		}
+
+		decision := rules.Decide(s.options.FolderRules, ignoreFiles, relPath, info.IsDir())
+		if decision.Skip {
+			if info.IsDir() {
+				log.Printf("skipping dir %s: %s\n", relPath, decision.Reason)
+			}
+			continue
+		}
+		if !info.IsDir() {
+			localFiles = append(localFiles, newLocalFile(s.rootDir, relPath, info))
+			continue
+		}
+
+		childDir := &scanDir{relDir: relPath, ignoreFiles: ignoreFiles}
+		if s.options.FollowSymlinks {
+			childDir.realPath = filepath.Join(dir.realPath, entry.Name())
+			if isSymlink {
+				childDir.realPath, err = filepath.EvalSymlinks(entryPath)
+				if err != nil {
+					scanErrors = append(scanErrors, &ScanError{Path: entryPath, Err: err})
+					continue
+				}
+				if isSameOrParentDir(childDir.realPath, dir.realPath) {
+					scanErrors = append(scanErrors, &ScanError{
+						Path: entryPath,
+						Err:  fmt.Errorf("symlink loop, it points to '%s' which contains it", childDir.realPath),
+					})
+					continue
+				}
+			}
+			if !s.markVisited(childDir.realPath) {
+				log.Printf("skipping dir %s: '%s' was already scanned\n", relPath, childDir.realPath)
+				continue
+			}
+		}
+		childDirs = append(childDirs, childDir)
+	}
+	return childDirs, localFiles, scanErrors
+}
+
+// markVisited records that a dir is getting scanned, returning false if it
+// already was
+func (s *scanner) markVisited(realPath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.visitedRealPaths[realPath] {
+		return false
+	}
+	s.visitedRealPaths[realPath] = true
+	return true
+}
+
+func isSameOrParentDir(dir, otherDir string) bool {
+	relPath, err := filepath.Rel(dir, otherDir)
+	return err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
@@ -2,4 +2,7 @@ module github.com/jastribl/photosync
 
 go 1.16
 
-require golang.org/x/oauth2 v0.0.0-20210819190943-2bc19b11175f
+require (
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/oauth2 v0.0.0-20210819190943-2bc19b11175f
+)
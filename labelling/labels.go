@@ -0,0 +1,110 @@
+package labelling
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jastribl/photosync/photos"
+)
+
+// DefaultTemplate is the label text template used when the config doesn't
+// have one, which is just the folder's name
+const DefaultTemplate = "{folder}"
+
+// Label is a text label for a folder, placed in the album right before the
+// folder's first media item
+type Label struct {
+	Text string
+	// Folder is the folder the label is for, see FolderInfo.Folder
+	Folder string
+	// Depth is the depth of the folder, 1 for header labels of top level
+	// folders and more for the sub-labels of the folders in them
+	Depth int
+	// AfterMediaItem is the media item the label goes after, nil when the
+	// label goes at the beginning of the album
+	AfterMediaItem *photos.MediaItem
+	// AfterLabel is the label of the parent folder when the folder's media
+	// items start at the same place as the parent's, in which case the label
+	// goes right after the parent's label instead of after AfterMediaItem
+	AfterLabel *Label
+}
+
+// GetLabels works out the labels for the folders from GetFolderInfo, using the
+// template for the top level folders and subTemplate for the folders in them.
+// Folders without any pictures in the album are skipped.
+func GetLabels(listOfFolderInfo []*FolderInfo, template, subTemplate string) []*Label {
+	labels := []*Label{}
+	labelsByFolder := map[*FolderInfo]*Label{}
+	for _, folderInfo := range listOfFolderInfo {
+		if len(folderInfo.MediaItems) == 0 {
+			log.Printf("No pictures from '%s' in the album, skipping\n", folderInfo.Path)
+			continue
+		}
+		labelTemplate := template
+		if folderInfo.Depth > 1 {
+			labelTemplate = subTemplate
+		}
+		label := &Label{
+			Text:           ExpandTemplate(labelTemplate, folderInfo),
+			Folder:         folderInfo.Folder,
+			Depth:          folderInfo.Depth,
+			AfterMediaItem: folderInfo.AfterMediaItem,
+		}
+		if parent := folderInfo.Parent; parent != nil && parent.firstIndexInAlbum == folderInfo.firstIndexInAlbum {
+			label.AfterLabel = labelsByFolder[parent]
+		}
+		labelsByFolder[folderInfo] = label
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+// ExpandTemplate gets the text of a folder's label from a template, replacing
+// {folder} with the folder's name, {path} with its path relative to the root
+// dir, {date range} with the dates of its media items and {count} with how
+// many media items it has
+func ExpandTemplate(template string, folderInfo *FolderInfo) string {
+	path := folderInfo.Folder
+	if path == UnsortedFolder {
+		path = UnsortedName
+	}
+	return strings.NewReplacer(
+		"{folder}", folderInfo.Name,
+		"{path}", path,
+		"{date range}", dateRange(folderInfo.MediaItems),
+		"{count}", strconv.Itoa(len(folderInfo.MediaItems)),
+	).Replace(template)
+}
+
+// dateRange gets the range of the media items' creation dates in local time,
+// e.g. "5 Jun 2021", "5–9 Jun 2021" or "28 May – 3 Jun 2021"
+func dateRange(mediaItems []*photos.MediaItem) string {
+	var first, last time.Time
+	for _, mediaItem := range mediaItems {
+		creationTime, err := time.Parse(time.RFC3339, mediaItem.MediaMetadata.CreationTime)
+		if err != nil {
+			continue
+		}
+		creationTime = creationTime.Local()
+		if first.IsZero() || creationTime.Before(first) {
+			first = creationTime
+		}
+		if last.IsZero() || creationTime.After(last) {
+			last = creationTime
+		}
+	}
+	switch {
+	case first.IsZero():
+		return ""
+	case first.Format("2006-01-02") == last.Format("2006-01-02"):
+		return first.Format("2 Jan 2006")
+	case first.Format("2006-01") == last.Format("2006-01"):
+		return first.Format("2") + "–" + last.Format("2 Jan 2006")
+	case first.Year() == last.Year():
+		return first.Format("2 Jan") + " – " + last.Format("2 Jan 2006")
+	default:
+		return first.Format("2 Jan 2006") + " – " + last.Format("2 Jan 2006")
+	}
+}
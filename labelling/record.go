@@ -0,0 +1,139 @@
+package labelling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/jastribl/photosync/photos"
+)
+
+// CreatedLabel is a text label that was added to an album
+type CreatedLabel struct {
+	AlbumID    string `json:"albumId"`
+	AlbumTitle string `json:"albumTitle"`
+	// Folder is the folder the label is for, see Label.Folder
+	Folder       string `json:"folder"`
+	Text         string `json:"text"`
+	EnrichmentID string `json:"enrichmentId"`
+	// AfterMediaItemID is the media item the label was added after, empty
+	// for the beginning of the album
+	AfterMediaItemID string `json:"afterMediaItemId,omitempty"`
+	// AfterLabelFolder is the folder of the label this one was added right
+	// after, if it was
+	AfterLabelFolder string `json:"afterLabelFolder,omitempty"`
+	CreatedAt        string `json:"createdAt"`
+}
+
+// Record keeps the labels that were added to each album, since the API has no
+// way of reading an album's labels back
+type Record struct {
+	path string
+	// labelsByAlbum maps album IDs to their labels, keyed by folder
+	labelsByAlbum map[string]map[string]*CreatedLabel
+}
+
+// OpenRecord reads the record at the path, which doesn't need to exist yet
+func OpenRecord(path string) (*Record, error) {
+	r := &Record{path: path, labelsByAlbum: map[string]map[string]*CreatedLabel{}}
+	recordJSON, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	createdLabels := []*CreatedLabel{}
+	if err := json.Unmarshal(recordJSON, &createdLabels); err != nil {
+		return nil, err
+	}
+	for _, createdLabel := range createdLabels {
+		if createdLabel.Folder == "" {
+			// recorded before labels had folders, when they were only for
+			// top level folders and had the folder's name as their text
+			createdLabel.Folder = createdLabel.Text
+		}
+		r.Put(createdLabel)
+	}
+	return r, nil
+}
+
+// Get gets the label for the folder that was added to the album, or nil if
+// there isn't one
+func (r *Record) Get(albumID, folder string) *CreatedLabel {
+	return r.labelsByAlbum[albumID][folder]
+}
+
+// ForAlbum gets the labels that were added to the album, sorted by folder so
+// parent folders come first
+func (r *Record) ForAlbum(albumID string) []*CreatedLabel {
+	createdLabels := []*CreatedLabel{}
+	for _, createdLabel := range r.labelsByAlbum[albumID] {
+		createdLabels = append(createdLabels, createdLabel)
+	}
+	sort.Slice(createdLabels, func(i, j int) bool {
+		return createdLabels[i].Folder < createdLabels[j].Folder
+	})
+	return createdLabels
+}
+
+// Put adds a label, replacing any label for the same folder in the album
+func (r *Record) Put(createdLabel *CreatedLabel) {
+	if r.labelsByAlbum[createdLabel.AlbumID] == nil {
+		r.labelsByAlbum[createdLabel.AlbumID] = map[string]*CreatedLabel{}
+	}
+	r.labelsByAlbum[createdLabel.AlbumID][createdLabel.Folder] = createdLabel
+}
+
+// Remove drops a label
+func (r *Record) Remove(createdLabel *CreatedLabel) {
+	delete(r.labelsByAlbum[createdLabel.AlbumID], createdLabel.Folder)
+}
+
+// Labels gets the labels that were added to the album, placed after the
+// album's media items or each other. Labels after media items that aren't in
+// the album any more are left out.
+func (r *Record) Labels(albumID string, albumMediaItems []*photos.MediaItem) []*Label {
+	mediaItemsByID := map[string]*photos.MediaItem{}
+	for _, mediaItem := range albumMediaItems {
+		mediaItemsByID[mediaItem.ID] = mediaItem
+	}
+	labels := []*Label{}
+	labelsByFolder := map[string]*Label{}
+	for _, createdLabel := range r.ForAlbum(albumID) {
+		label := &Label{Text: createdLabel.Text, Folder: createdLabel.Folder}
+		if createdLabel.AfterLabelFolder != "" {
+			label.AfterLabel = labelsByFolder[createdLabel.AfterLabelFolder]
+			if label.AfterLabel == nil {
+				continue
+			}
+		} else if createdLabel.AfterMediaItemID != "" {
+			label.AfterMediaItem = mediaItemsByID[createdLabel.AfterMediaItemID]
+			if label.AfterMediaItem == nil {
+				continue
+			}
+		}
+		labelsByFolder[label.Folder] = label
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+// Save writes the record
+func (r *Record) Save() error {
+	createdLabels := []*CreatedLabel{}
+	albumIDs := []string{}
+	for albumID := range r.labelsByAlbum {
+		albumIDs = append(albumIDs, albumID)
+	}
+	sort.Strings(albumIDs)
+	for _, albumID := range albumIDs {
+		createdLabels = append(createdLabels, r.ForAlbum(albumID)...)
+	}
+	recordJSON, err := json.MarshalIndent(createdLabels, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, recordJSON, 0644)
+}
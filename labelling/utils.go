@@ -1,115 +1,142 @@
 package labelling
 
 import (
-	"io/ioutil"
-	"log"
-	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/jastribl/photosync/files"
 	"github.com/jastribl/photosync/photos"
 )
 
-// 2021
-var (
-	FOLDER_DENY_REGEXS = [...]*regexp.Regexp{
-		regexp.MustCompile(".*[pP]ictures [fF]rom .*$"),
-		regexp.MustCompile(".*[pP]hotos [fF]rom .*$"),
-		regexp.MustCompile("^Wendy$"),
-	}
+// DefaultDepth is how deep the folders get labelled when the config doesn't
+// say, which is only the top level folders
+const DefaultDepth = 1
 
-	FOLDER_ALLOW_REGEXS = [...]*regexp.Regexp{
-		regexp.MustCompile("^Photos from Michael$"),
-	}
-)
+// UnsortedFolder is the folder of the files that are loose in the root dir
+const UnsortedFolder = "."
 
-type FolderInfo struct {
-	Path          string
-	NumMediaItems int
-	LastMediaItem *photos.MediaItem
-}
+// UnsortedName is the name the files loose in the root dir are labelled with
+const UnsortedName = "Unsorted"
 
-func ShouldIgnoreFolder(folderName string) bool {
-	for _, denyRegex := range FOLDER_DENY_REGEXS {
-		if denyRegex.MatchString(folderName) {
-			denyRuling := true
-			for _, allowRegex := range FOLDER_ALLOW_REGEXS {
-				if allowRegex.MatchString(folderName) {
-					denyRuling = false
-					break
-				}
-			}
-			if denyRuling {
-				return true
-			}
-		}
-	}
-	return false
+// FolderInfo is a folder under the root dir and its media items in an album
+type FolderInfo struct {
+	// Path is the folder's path, ending in a slash
+	Path string
+	// Folder is the folder relative to the root dir using forward slashes, or
+	// UnsortedFolder for the files loose in the root dir
+	Folder string
+	// Name is the folder's own name, or UnsortedName
+	Name string
+	// Depth is 1 for top level folders, 2 for the folders in them and so on
+	Depth int
+	// Parent is the info of the folder this one is in, nil at the top level
+	Parent *FolderInfo
+	// MediaItems are the album's media items that are in the folder or any
+	// folder under it, in album order
+	MediaItems []*photos.MediaItem
+	// AfterMediaItem is the album's media item right before the folder's
+	// first media item, nil when the folder's media items start the album
+	AfterMediaItem *photos.MediaItem
+
+	firstIndexInAlbum int
 }
 
-func GetTopLevelFolderInfo(
+// GetFolderInfo finds the media items of the album that are in each folder
+// under the root dir, down to the given depth. Files loose in the root dir are
+// grouped into an UnsortedFolder folder. The folders are sorted by path, so
+// each folder comes before the folders in it.
+func GetFolderInfo(
 	rootDir string,
 	client *photos.Client,
 	album *photos.Album,
-) []*FolderInfo {
-	albumMediaItems, err := client.GetAllMediaItemsForAlbum(album)
+	localFiles []*files.LocalFile,
+	equivalence *files.FilenameEquivalence,
+	depth int,
+) ([]*FolderInfo, error) {
+	albumMediaItems, err := client.GetAllMediaItemsForAlbumWithCache(album)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return folderInfoForAlbum(rootDir, albumMediaItems, localFiles, equivalence, depth), nil
+}
 
-	lowercaseFilenameToAlbumMediaMap := photos.MediaItemsToLowercaseFilenameMap(albumMediaItems)
-
-	lowercaseFilenameToIndexInAlbum := map[string]int{}
+func folderInfoForAlbum(
+	rootDir string,
+	albumMediaItems []*photos.MediaItem,
+	localFiles []*files.LocalFile,
+	equivalence *files.FilenameEquivalence,
+	depth int,
+) []*FolderInfo {
+	stemToIndexesInAlbum := map[string][]int{}
 	for i, item := range albumMediaItems {
-		lowercaseFilenameToIndexInAlbum[strings.ToLower(item.Filename)] = i
+		stem := equivalence.Stem(item.Filename)
+		stemToIndexesInAlbum[stem] = append(stemToIndexesInAlbum[stem], i)
 	}
 
-	// Find all top level files and assert they are all topLevelDirs
-	topLevelDirs, err := ioutil.ReadDir(rootDir)
-	if err != nil {
-		log.Fatal(err)
-	}
-	listOfFolderInfo := []*FolderInfo{}
-	for _, topLevelDir := range topLevelDirs {
-		if topLevelDir.Name() == ".DS_Store" {
+	// Group the files of the whole root dir by each of their folders down to
+	// the depth
+	folderToFilenames := map[string][]string{}
+	for _, localFile := range localFiles {
+		dirs := strings.Split(localFile.RelPath, "/")
+		dirs = dirs[:len(dirs)-1]
+		if len(dirs) == 0 {
+			folderToFilenames[UnsortedFolder] = append(folderToFilenames[UnsortedFolder], localFile.Name())
 			continue
 		}
-		if !topLevelDir.IsDir() {
-			log.Fatalf("Found non-dir in top level of given root dir - must be  dir: %s", topLevelDir.Name())
+		for d := 1; d <= depth && d <= len(dirs); d++ {
+			folder := strings.Join(dirs[:d], "/")
+			folderToFilenames[folder] = append(folderToFilenames[folder], localFile.Name())
 		}
+	}
+	folders := []string{}
+	for folder := range folderToFilenames {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
 
-		fullPathWithRoot := rootDir + topLevelDir.Name() + "/"
-		if ShouldIgnoreFolder(fullPathWithRoot) {
-			log.Printf("Ignoring path 2: %s\n", fullPathWithRoot)
-			continue
+	folderInfoByFolder := map[string]*FolderInfo{}
+	listOfFolderInfo := []*FolderInfo{}
+	for _, folder := range folders {
+		folderInfo := &FolderInfo{
+			Path:              rootDir + folder + "/",
+			Folder:            folder,
+			Name:              folder[strings.LastIndex(folder, "/")+1:],
+			Depth:             strings.Count(folder, "/") + 1,
+			MediaItems:        []*photos.MediaItem{},
+			firstIndexInAlbum: -1,
+		}
+		if slashIndex := strings.LastIndex(folder, "/"); slashIndex != -1 {
+			folderInfo.Parent = folderInfoByFolder[folder[:slashIndex]]
+		}
+		if folder == UnsortedFolder {
+			folderInfo.Path = rootDir
+			folderInfo.Name = UnsortedName
 		}
 
-		lowercaseFileNamesInDir := files.GetAllLowercaseFilenamesInDir(
-			fullPathWithRoot,
-			FOLDER_DENY_REGEXS[:],
-			FOLDER_ALLOW_REGEXS[:],
-		)
-
-		highestIndexInAlbum := -1
-		numMediaItemsInDir := 0
-		for _, lowercaseFilename := range lowercaseFileNamesInDir {
-			// find highest index item in folder
-			indexInAlbum, foundFile := lowercaseFilenameToIndexInAlbum[lowercaseFilename]
-			if foundFile && (highestIndexInAlbum == -1 || indexInAlbum > highestIndexInAlbum) {
-				highestIndexInAlbum = indexInAlbum
+		indexesInDir := map[int]bool{}
+		for _, filename := range folderToFilenames[folder] {
+			for _, indexInAlbum := range stemToIndexesInAlbum[equivalence.Stem(filename)] {
+				if equivalence.Equivalent(filename, albumMediaItems[indexInAlbum].Filename) {
+					indexesInDir[indexInAlbum] = true
+				}
 			}
-
-			// also find the number of items in each folder
-			numMediaItemsInDir += len(lowercaseFilenameToAlbumMediaMap[lowercaseFilename])
 		}
-
-		folderInfo := &FolderInfo{
-			Path:          fullPathWithRoot,
-			NumMediaItems: numMediaItemsInDir,
+		indexes := []int{}
+		for indexInAlbum := range indexesInDir {
+			indexes = append(indexes, indexInAlbum)
+		}
+		sort.Ints(indexes)
+		for _, indexInAlbum := range indexes {
+			folderInfo.MediaItems = append(folderInfo.MediaItems, albumMediaItems[indexInAlbum])
 		}
-		if highestIndexInAlbum != -1 {
-			folderInfo.LastMediaItem = albumMediaItems[highestIndexInAlbum]
+		if len(indexes) > 0 {
+			folderInfo.firstIndexInAlbum = indexes[0]
+			if indexes[0] > 0 {
+				folderInfo.AfterMediaItem = albumMediaItems[indexes[0]-1]
+			}
 		}
+
+		folderInfoByFolder[folder] = folderInfo
 		listOfFolderInfo = append(listOfFolderInfo, folderInfo)
 	}
 
@@ -0,0 +1,263 @@
+package match
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jastribl/photosync/files"
+	"github.com/jastribl/photosync/photos"
+)
+
+// Candidate is a media item that a local file could be
+type Candidate struct {
+	MediaItem *photos.MediaItem
+	*Score
+}
+
+// Pair is a local file and the media item it was matched with
+type Pair struct {
+	LocalFile *files.LocalFile
+	MediaItem *photos.MediaItem
+	*Score
+}
+
+// Ambiguity is a local file with several candidates that scored too close to
+// each other to pick one
+type Ambiguity struct {
+	LocalFile  *files.LocalFile
+	Candidates []*Candidate
+}
+
+// Result is the outcome of matching local files with media items
+type Result struct {
+	// Matches has the best match of each matched local file, in the order of
+	// the local files. A media item is only the best match of more than one
+	// local file when the local files are copies of each other.
+	Matches   []*Pair
+	Ambiguous []*Ambiguity
+	// UnmatchedLocal are the local files without any candidate, apart from the
+	// ones in Covered
+	UnmatchedLocal []*files.LocalFile
+	// Covered are the local files without any candidate that are part of an
+	// asset whose primary file is matched or ambiguous, like the video of a
+	// Live Photo, so they count as present
+	Covered []*files.LocalFile
+	// UnmatchedRemote are the media items that aren't matched with a local file
+	// or a candidate of an ambiguous one
+	UnmatchedRemote []*photos.MediaItem
+}
+
+// mediaItemIndex finds the media items that could match a local file
+type mediaItemIndex struct {
+	byStem map[string][]*photos.MediaItem
+	byID   map[string]*photos.MediaItem
+	// byCreationTime is sorted by creationTimes
+	byCreationTime []*photos.MediaItem
+	creationTimes  []time.Time
+}
+
+func newMediaItemIndex(mediaItems []*photos.MediaItem, equivalence *files.FilenameEquivalence) *mediaItemIndex {
+	index := &mediaItemIndex{
+		byStem: map[string][]*photos.MediaItem{},
+		byID:   map[string]*photos.MediaItem{},
+	}
+	for _, mediaItem := range mediaItems {
+		stem := equivalence.Stem(mediaItem.Filename)
+		index.byStem[stem] = append(index.byStem[stem], mediaItem)
+		index.byID[mediaItem.ID] = mediaItem
+		if _, err := time.Parse(time.RFC3339, mediaItem.MediaMetadata.CreationTime); err == nil {
+			index.byCreationTime = append(index.byCreationTime, mediaItem)
+		}
+	}
+	sort.SliceStable(index.byCreationTime, func(i, j int) bool {
+		return creationTime(index.byCreationTime[i]).Before(creationTime(index.byCreationTime[j]))
+	})
+	for _, mediaItem := range index.byCreationTime {
+		index.creationTimes = append(index.creationTimes, creationTime(mediaItem))
+	}
+	return index
+}
+
+func creationTime(mediaItem *photos.MediaItem) time.Time {
+	t, _ := time.Parse(time.RFC3339, mediaItem.MediaMetadata.CreationTime)
+	return t
+}
+
+// createdAround gets the media items created within sameTimeTolerance of t
+func (index *mediaItemIndex) createdAround(t time.Time) []*photos.MediaItem {
+	start := sort.Search(len(index.creationTimes), func(i int) bool {
+		return !index.creationTimes[i].Before(t.Add(-sameTimeTolerance))
+	})
+	mediaItems := []*photos.MediaItem{}
+	for i := start; i < len(index.creationTimes) && !index.creationTimes[i].After(t.Add(sameTimeTolerance)); i++ {
+		mediaItems = append(mediaItems, index.byCreationTime[i])
+	}
+	return mediaItems
+}
+
+// candidatesFor gets the media items worth scoring for the local file: the
+// ones with the same filename stem, plus for StrategyScore the ones with the
+// same capture time and for StrategyHash the already hashed ones with the same
+// hash, unless the local file can't hash the same as a downloaded media item
+func (m *Matcher) candidatesFor(localFile *files.LocalFile, index *mediaItemIndex) ([]*photos.MediaItem, error) {
+	candidates := []*photos.MediaItem{}
+	seen := map[string]bool{}
+	addCandidates := func(mediaItems []*photos.MediaItem) {
+		for _, mediaItem := range mediaItems {
+			if !seen[mediaItem.ID] {
+				seen[mediaItem.ID] = true
+				candidates = append(candidates, mediaItem)
+			}
+		}
+	}
+
+	addCandidates(index.byStem[m.equivalence.Stem(localFile.Name())])
+	switch m.strategy {
+	case StrategyScore:
+		if md := m.Metadata(localFile); md != nil && !md.CaptureTime.IsZero() {
+			shifts := []time.Duration{0}
+			if !md.CaptureTimeHasZone {
+				for shift := time.Hour; shift <= maxTimeZoneShift; shift += time.Hour {
+					shifts = append(shifts, shift, -shift)
+				}
+			}
+			for _, shift := range shifts {
+				addCandidates(index.createdAround(md.CaptureTime.Add(shift)))
+			}
+		}
+	case StrategyHash:
+		if md := m.Metadata(localFile); md != nil && (md.IsVideo || md.HasLocation) {
+			break
+		}
+		localHash, err := localFile.Hash()
+		if err != nil {
+			return nil, err
+		}
+		hashMatches, err := m.client.GetMediaItemsWithHashWithCache(localHash)
+		if err != nil {
+			return nil, err
+		}
+		for _, hashMatch := range hashMatches {
+			if mediaItem, found := index.byID[hashMatch.ID]; found {
+				addCandidates([]*photos.MediaItem{mediaItem})
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// scoredLocalFile is a local file with its accepted candidates, best first
+type scoredLocalFile struct {
+	localFile  *files.LocalFile
+	candidates []*Candidate
+}
+
+// Match matches the local files with the media items. Each local file is
+// matched with its best scoring candidate that the strategy accepts, going
+// from the local files with the best scores down and preferring media items
+// that aren't matched yet. When the two best candidates score within
+// ambiguityMargin of each other the local file is ambiguous instead.
+func (m *Matcher) Match(localFiles []*files.LocalFile, mediaItems []*photos.MediaItem) (*Result, error) {
+	index := newMediaItemIndex(mediaItems, m.equivalence)
+	result := &Result{
+		Matches:         []*Pair{},
+		Ambiguous:       []*Ambiguity{},
+		UnmatchedLocal:  []*files.LocalFile{},
+		Covered:         []*files.LocalFile{},
+		UnmatchedRemote: []*photos.MediaItem{},
+	}
+
+	scoredLocalFiles := []*scoredLocalFile{}
+	unmatchedLocal := []*files.LocalFile{}
+	for _, localFile := range localFiles {
+		mediaItemCandidates, err := m.candidatesFor(localFile, index)
+		if err != nil {
+			return nil, err
+		}
+		scored := &scoredLocalFile{localFile: localFile, candidates: []*Candidate{}}
+		for _, mediaItem := range mediaItemCandidates {
+			score, err := m.Score(localFile, mediaItem)
+			if err != nil {
+				return nil, err
+			}
+			if m.accepts(score) {
+				scored.candidates = append(scored.candidates, &Candidate{MediaItem: mediaItem, Score: score})
+			}
+		}
+		if len(scored.candidates) == 0 {
+			unmatchedLocal = append(unmatchedLocal, localFile)
+			continue
+		}
+		sort.SliceStable(scored.candidates, func(i, j int) bool {
+			return scored.candidates[i].Total > scored.candidates[j].Total
+		})
+		scoredLocalFiles = append(scoredLocalFiles, scored)
+	}
+
+	// go from the most certain matches down, so they get their media items
+	// before less certain ones can
+	byBestScore := make([]*scoredLocalFile, len(scoredLocalFiles))
+	copy(byBestScore, scoredLocalFiles)
+	sort.SliceStable(byBestScore, func(i, j int) bool {
+		return byBestScore[i].candidates[0].Total > byBestScore[j].candidates[0].Total
+	})
+	matchedIDs := map[string]bool{}
+	pairByLocalFile := map[*files.LocalFile]*Pair{}
+	ambiguityByLocalFile := map[*files.LocalFile]*Ambiguity{}
+	for _, scored := range byBestScore {
+		available := []*Candidate{}
+		for _, candidate := range scored.candidates {
+			if !matchedIDs[candidate.MediaItem.ID] {
+				available = append(available, candidate)
+			}
+		}
+		if len(available) == 0 {
+			// every candidate is matched already, so this is a copy of
+			// another local file
+			available = scored.candidates
+		}
+
+		if len(available) > 1 && available[0].Total-available[1].Total < ambiguityMargin {
+			ambiguous := []*Candidate{}
+			for _, candidate := range available {
+				if available[0].Total-candidate.Total < ambiguityMargin {
+					ambiguous = append(ambiguous, candidate)
+				}
+			}
+			ambiguityByLocalFile[scored.localFile] = &Ambiguity{LocalFile: scored.localFile, Candidates: ambiguous}
+			continue
+		}
+
+		best := available[0]
+		matchedIDs[best.MediaItem.ID] = true
+		pairByLocalFile[scored.localFile] = &Pair{LocalFile: scored.localFile, MediaItem: best.MediaItem, Score: best.Score}
+	}
+
+	// report in the order of the local files rather than by score
+	ambiguousIDs := map[string]bool{}
+	hasCandidates := map[*files.LocalFile]bool{}
+	for _, scored := range scoredLocalFiles {
+		hasCandidates[scored.localFile] = true
+		if pair, found := pairByLocalFile[scored.localFile]; found {
+			result.Matches = append(result.Matches, pair)
+		} else if ambiguity, found := ambiguityByLocalFile[scored.localFile]; found {
+			result.Ambiguous = append(result.Ambiguous, ambiguity)
+			for _, candidate := range ambiguity.Candidates {
+				ambiguousIDs[candidate.MediaItem.ID] = true
+			}
+		}
+	}
+	for _, localFile := range unmatchedLocal {
+		if asset := localFile.Asset; asset != nil && asset.Primary != localFile && hasCandidates[asset.Primary] {
+			result.Covered = append(result.Covered, localFile)
+		} else {
+			result.UnmatchedLocal = append(result.UnmatchedLocal, localFile)
+		}
+	}
+	for _, mediaItem := range mediaItems {
+		if !matchedIDs[mediaItem.ID] && !ambiguousIDs[mediaItem.ID] {
+			result.UnmatchedRemote = append(result.UnmatchedRemote, mediaItem)
+		}
+	}
+	return result, nil
+}
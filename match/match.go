@@ -0,0 +1,119 @@
+package match
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jastribl/photosync/files"
+	"github.com/jastribl/photosync/metadata"
+	"github.com/jastribl/photosync/photos"
+)
+
+// Strategy is how local files and media items are matched
+type Strategy string
+
+const (
+	// StrategyFilename matches on equivalent filenames, see
+	// files.FilenameEquivalence
+	StrategyFilename Strategy = "filename"
+	// StrategyFilenameAndDate also needs the local file's capture time, or its
+	// modification time if it has none, to be within a day of the media item's
+	// creation time
+	StrategyFilenameAndDate Strategy = "filename+date"
+	// StrategyHash matches on the SHA-256 hash of the file's bytes, which needs
+	// each media item to be downloaded once. Videos and geotagged photos can't
+	// hash the same once downloaded, so those, and files whose hash differs,
+	// fall back to StrategyFilenameAndDate.
+	StrategyHash Strategy = "hash"
+	// StrategyScore matches on the total score of the filename, capture time,
+	// dimensions and camera, so it also finds renamed files
+	StrategyScore Strategy = "score"
+)
+
+// Strategies are all the strategies, for usage messages
+var Strategies = []Strategy{StrategyFilename, StrategyFilenameAndDate, StrategyHash, StrategyScore}
+
+// ParseStrategy parses a strategy name, the empty string being
+// StrategyFilename
+func ParseStrategy(name string) (Strategy, error) {
+	if name == "" {
+		return StrategyFilename, nil
+	}
+	for _, strategy := range Strategies {
+		if Strategy(name) == strategy {
+			return strategy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown match strategy '%s', must be one of: %s", name, strategyNames())
+}
+
+func strategyNames() string {
+	names := []string{}
+	for _, strategy := range Strategies {
+		names = append(names, string(strategy))
+	}
+	return strings.Join(names, ", ")
+}
+
+// Matcher matches local files with media items using a strategy
+type Matcher struct {
+	client   *photos.Client
+	strategy Strategy
+	// minScore is the lowest total score that StrategyScore accepts
+	minScore    int
+	equivalence *files.FilenameEquivalence
+	// metadataByPath caches the metadata read from local files, nil when it
+	// couldn't be read
+	metadataByPath map[string]*metadata.Metadata
+}
+
+// NewMatcher gets a new Matcher, the client is used to look up media item
+// hashes. minScore is only used by StrategyScore, 0 meaning DefaultMinScore.
+// Filenames are compared with the equivalence.
+func NewMatcher(
+	client *photos.Client,
+	strategy Strategy,
+	minScore int,
+	equivalence *files.FilenameEquivalence,
+) *Matcher {
+	if minScore == 0 {
+		minScore = DefaultMinScore
+	}
+	return &Matcher{
+		client:         client,
+		strategy:       strategy,
+		minScore:       minScore,
+		equivalence:    equivalence,
+		metadataByPath: map[string]*metadata.Metadata{},
+	}
+}
+
+// Strategy gets the matcher's strategy
+func (m *Matcher) Strategy() Strategy {
+	return m.strategy
+}
+
+// Metadata gets the metadata of the local file, or nil if it isn't a file
+// type that metadata can be read from
+func (m *Matcher) Metadata(localFile *files.LocalFile) *metadata.Metadata {
+	md, cached := m.metadataByPath[localFile.Path]
+	if !cached {
+		md, _ = metadata.ReadFile(localFile.Path)
+		m.metadataByPath[localFile.Path] = md
+	}
+	return md
+}
+
+// accepts returns if the score is good enough for the strategy
+func (m *Matcher) accepts(score *Score) bool {
+	switch m.strategy {
+	case StrategyFilenameAndDate:
+		return score.sameFilename && score.datesMatch
+	case StrategyHash:
+		return score.sameHash || (score.sameFilename && score.datesMatch)
+	case StrategyScore:
+		return score.Total >= m.minScore
+	default:
+		return score.sameFilename
+	}
+}
@@ -0,0 +1,215 @@
+package match
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jastribl/photosync/files"
+	"github.com/jastribl/photosync/photos"
+)
+
+// How much each signal adds to a score, the negative ones being evidence that
+// a local file and a media item are different
+const (
+	scoreSameFilename             = 40
+	scoreEquivalentFilename       = 35
+	scoreSuffixEquivalentFilename = 25
+	scoreSameStem                 = 10
+	scoreSameHash                 = 100
+
+	scoreSameTime    = 30
+	scoreShiftedTime = 20
+	scoreCloseTime   = 10
+	scoreFarTime     = -30
+
+	scoreSameDimensions      = 15
+	scoreSameAspectRatio     = 5
+	scoreDifferentDimensions = -10
+
+	scoreSameCamera      = 15
+	scoreDifferentCamera = -20
+
+	scoreDifferentKind = -50
+)
+
+const (
+	// DefaultMinScore is the lowest total score that StrategyScore accepts by
+	// default, which a matching filename reaches on its own
+	DefaultMinScore = 40
+
+	// dateTolerance is how far apart the times can be and still be close,
+	// which is what StrategyFilenameAndDate needs
+	dateTolerance = 24 * time.Hour
+	// sameTimeTolerance is how far apart the times can be and still be the
+	// same, allowing for rounding
+	sameTimeTolerance = 2 * time.Second
+	// maxTimeZoneShift is the biggest difference between two time zones
+	maxTimeZoneShift = 14 * time.Hour
+
+	// ambiguityMargin is how close the scores of the two best candidates can
+	// be before neither is picked
+	ambiguityMargin = 10
+)
+
+// Score is how likely it is that a local file and a media item are the same
+type Score struct {
+	Total int
+	// Reasons explain the total, one for each signal that counted
+	Reasons []string
+
+	sameFilename bool
+	datesMatch   bool
+	sameHash     bool
+}
+
+func (s *Score) add(points int, reasonFormat string, reasonArgs ...interface{}) {
+	s.Total += points
+	s.Reasons = append(s.Reasons, fmt.Sprintf("%s (%+d)", fmt.Sprintf(reasonFormat, reasonArgs...), points))
+}
+
+// Score scores how likely it is that the local file and the media item are
+// the same. The hash is only compared for StrategyHash, since it needs the
+// media item to be downloaded, and only when the downloaded bytes can be the
+// same as the local file's.
+func (m *Matcher) Score(localFile *files.LocalFile, mediaItem *photos.MediaItem) (*Score, error) {
+	score := &Score{}
+	m.scoreFilename(score, localFile, mediaItem)
+	m.scoreCaptureTime(score, localFile, mediaItem)
+
+	if md := m.Metadata(localFile); md != nil {
+		if md.IsVideo != (mediaItem.MediaMetadata.Video != nil) {
+			score.add(scoreDifferentKind, "photo and video")
+		}
+		scoreDimensions(score, md.Width, md.Height, mediaItem)
+		scoreCamera(score, md.CameraModel, mediaItem)
+	}
+
+	if m.strategy == StrategyHash && m.hashComparable(localFile, mediaItem) {
+		localHash, err := localFile.Hash()
+		if err != nil {
+			return nil, err
+		}
+		mediaItemHash, err := m.client.GetMediaItemHashWithCache(mediaItem)
+		if err != nil {
+			return nil, err
+		}
+		if localHash == mediaItemHash {
+			score.sameHash = true
+			score.add(scoreSameHash, "same hash")
+		}
+	}
+	return score, nil
+}
+
+// hashComparable returns if the media item's downloaded bytes can hash the same
+// as the local file. Google Photos strips the location from downloaded photos
+// and only gives back the processed version of videos, so geotagged photos and
+// videos never hash the same as their originals.
+func (m *Matcher) hashComparable(localFile *files.LocalFile, mediaItem *photos.MediaItem) bool {
+	if mediaItem.MediaMetadata.Video != nil {
+		return false
+	}
+	md := m.Metadata(localFile)
+	return md == nil || (!md.IsVideo && !md.HasLocation)
+}
+
+func (m *Matcher) scoreFilename(score *Score, localFile *files.LocalFile, mediaItem *photos.MediaItem) {
+	switch m.equivalence.Compare(localFile.Name(), mediaItem.Filename) {
+	case files.SameFilenames:
+		score.sameFilename = true
+		score.add(scoreSameFilename, "same filename")
+	case files.EquivalentFilenames:
+		score.sameFilename = true
+		score.add(scoreEquivalentFilename, "equivalent filename")
+	case files.SuffixEquivalentFilenames:
+		score.sameFilename = true
+		score.add(scoreSuffixEquivalentFilename, "equivalent filename apart from a suffix")
+	case files.SameStemFilenames:
+		score.add(scoreSameStem, "same filename apart from the extension")
+	}
+}
+
+// scoreCaptureTime compares the local file's capture time, or its
+// modification time if it has none, with the media item's creation time
+func (m *Matcher) scoreCaptureTime(score *Score, localFile *files.LocalFile, mediaItem *photos.MediaItem) {
+	creationTime, err := time.Parse(time.RFC3339, mediaItem.MediaMetadata.CreationTime)
+	if err != nil {
+		return
+	}
+	localTime := localFile.ModTime
+	fromMetadata, hasZone := false, true
+	if md := m.Metadata(localFile); md != nil && !md.CaptureTime.IsZero() {
+		localTime = md.CaptureTime
+		fromMetadata, hasZone = true, md.CaptureTimeHasZone
+	}
+
+	difference := absDuration(localTime.Sub(creationTime))
+	score.datesMatch = difference <= dateTolerance
+	hoursShifted := difference.Round(time.Hour)
+	switch {
+	case difference <= sameTimeTolerance:
+		score.add(scoreSameTime, "same capture time")
+	case !hasZone && hoursShifted <= maxTimeZoneShift && absDuration(difference-hoursShifted) <= sameTimeTolerance:
+		score.add(scoreShiftedTime, "capture time %d hours apart, as if in another time zone", int(hoursShifted.Hours()))
+	case score.datesMatch:
+		score.add(scoreCloseTime, "capture time within a day")
+	case fromMetadata:
+		score.add(scoreFarTime, "capture time more than a day apart")
+	}
+}
+
+func scoreDimensions(score *Score, localWidth, localHeight int, mediaItem *photos.MediaItem) {
+	width, widthErr := strconv.Atoi(mediaItem.MediaMetadata.Width)
+	height, heightErr := strconv.Atoi(mediaItem.MediaMetadata.Height)
+	if localWidth <= 0 || localHeight <= 0 || widthErr != nil || heightErr != nil || width <= 0 || height <= 0 {
+		return
+	}
+	switch {
+	case (localWidth == width && localHeight == height) || (localWidth == height && localHeight == width):
+		score.add(scoreSameDimensions, "same dimensions")
+	case sameAspectRatio(localWidth, localHeight, width, height) || sameAspectRatio(localWidth, localHeight, height, width):
+		// storage saver and edited items can be resized
+		score.add(scoreSameAspectRatio, "same aspect ratio")
+	default:
+		score.add(scoreDifferentDimensions, "different dimensions")
+	}
+}
+
+// sameAspectRatio returns if the aspect ratios are within 1% of each other
+func sameAspectRatio(width1, height1, width2, height2 int) bool {
+	cross1 := float64(width1) * float64(height2)
+	cross2 := float64(width2) * float64(height1)
+	difference := cross1 - cross2
+	if difference < 0 {
+		difference = -difference
+	}
+	return difference <= cross1/100
+}
+
+func scoreCamera(score *Score, localCameraModel string, mediaItem *photos.MediaItem) {
+	cameraModel := ""
+	if mediaItem.MediaMetadata.Photo != nil {
+		cameraModel = mediaItem.MediaMetadata.Photo.CameraModel
+	} else if mediaItem.MediaMetadata.Video != nil {
+		cameraModel = mediaItem.MediaMetadata.Video.CameraModel
+	}
+	localCameraModel = strings.TrimSpace(localCameraModel)
+	cameraModel = strings.TrimSpace(cameraModel)
+	if localCameraModel == "" || cameraModel == "" {
+		return
+	}
+	if strings.EqualFold(localCameraModel, cameraModel) {
+		score.add(scoreSameCamera, "same camera")
+	} else {
+		score.add(scoreDifferentCamera, "different camera")
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
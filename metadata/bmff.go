@@ -0,0 +1,543 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// HEIC, MP4 and MOV files are all ISO base media files (BMFF), made of nested
+// boxes (also called atoms)
+
+// maxBoxReadSize limits how much of a single box gets read into memory, the
+// boxes with metadata are all small
+const maxBoxReadSize = 16 << 20
+
+// bmffEpoch is the time that BMFF times are counted from
+var bmffEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// iso6709Regex matches the start of an ISO 6709 location like
+// "+37.3349-122.0090+010.000/"
+var iso6709Regex = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)`)
+
+type box struct {
+	typ string
+	// start and end are where the box's data is, after its header
+	start int64
+	end   int64
+}
+
+// isBMFFBoxType returns if the type is one a BMFF file can start with
+func isBMFFBoxType(typ string) bool {
+	switch typ {
+	case "ftyp", "moov", "mdat", "wide", "free", "skip", "pnot":
+		return true
+	}
+	return false
+}
+
+// readBoxes reads the headers of the boxes between start and end
+func readBoxes(r io.ReaderAt, start, end int64) ([]*box, error) {
+	boxes := []*box{}
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// the box goes to the end
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		// compare against what is left rather than adding, which could
+		// overflow for a huge size
+		if size < headerSize || size > end-offset {
+			return nil, fmt.Errorf("bad size for box '%s'", string(header[4:8]))
+		}
+		boxes = append(boxes, &box{
+			typ:   string(header[4:8]),
+			start: offset + headerSize,
+			end:   offset + size,
+		})
+		offset += size
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []*box, typ string) *box {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b
+		}
+	}
+	return nil
+}
+
+// readChildren reads the boxes inside a box, skipping the first skip bytes
+func readChildren(r io.ReaderAt, b *box, skip int64) ([]*box, error) {
+	return readBoxes(r, b.start+skip, b.end)
+}
+
+func readBoxData(r io.ReaderAt, b *box) ([]byte, error) {
+	if b.end-b.start > maxBoxReadSize {
+		return nil, fmt.Errorf("box '%s' is too big", b.typ)
+	}
+	data := make([]byte, b.end-b.start)
+	_, err := r.ReadAt(data, b.start)
+	return data, err
+}
+
+// readBMFF reads a HEIC, MP4 or MOV file
+func readBMFF(r io.ReaderAt, size int64, md *Metadata) error {
+	topLevelBoxes, err := readBoxes(r, 0, size)
+	if err != nil {
+		return err
+	}
+	if moov := findBox(topLevelBoxes, "moov"); moov != nil {
+		md.IsVideo = true
+		return readMovie(r, moov, md)
+	}
+	if meta := findBox(topLevelBoxes, "meta"); meta != nil {
+		return readHEIF(r, meta, md)
+	}
+	return ErrUnsupported
+}
+
+// fieldReader reads big endian fields out of a box's data, remembering if it
+// ran out of data
+type fieldReader struct {
+	data   []byte
+	offset int
+	short  bool
+}
+
+// read gets the next n bytes, or nil once the data has run out or n is a bad
+// size read from a corrupt file
+func (f *fieldReader) read(n int) []byte {
+	if f.short || n < 0 || n > len(f.data)-f.offset {
+		f.short = true
+		return nil
+	}
+	field := f.data[f.offset : f.offset+n]
+	f.offset += n
+	return field
+}
+
+// uint reads an unsigned int of 0, 1, 2, 4 or 8 bytes
+func (f *fieldReader) uint(n int) uint64 {
+	field := f.read(n)
+	value := uint64(0)
+	for _, b := range field {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+// readHEIF reads the EXIF item and the image size of a HEIC file
+func readHEIF(r io.ReaderAt, meta *box, md *Metadata) error {
+	// meta is a full box, with 4 bytes of version and flags
+	metaChildren, err := readChildren(r, meta, 4)
+	if err != nil {
+		return err
+	}
+
+	exifItemID, err := findHEIFItemID(r, findBox(metaChildren, "iinf"), "Exif")
+	if err != nil {
+		return err
+	}
+	if exifItemID != 0 {
+		exifData, err := readHEIFItem(r, findBox(metaChildren, "iloc"), exifItemID)
+		if err != nil {
+			return err
+		}
+		// the EXIF item starts with the offset to the TIFF header
+		if len(exifData) < 4 {
+			return errors.New("EXIF item too short")
+		}
+		tiffOffset := 4 + int64(binary.BigEndian.Uint32(exifData[0:4]))
+		if tiffOffset > int64(len(exifData)) {
+			return errors.New("bad EXIF item offset")
+		}
+		if err := readTIFF(exifData[tiffOffset:], md); err != nil {
+			return err
+		}
+	}
+
+	if md.Width == 0 || md.Height == 0 {
+		// use the biggest image size, which is the full image rather than a
+		// tile or thumbnail
+		if iprp := findBox(metaChildren, "iprp"); iprp != nil {
+			iprpChildren, err := readChildren(r, iprp, 0)
+			if err != nil {
+				return err
+			}
+			if ipco := findBox(iprpChildren, "ipco"); ipco != nil {
+				properties, err := readChildren(r, ipco, 0)
+				if err != nil {
+					return err
+				}
+				for _, property := range properties {
+					if property.typ != "ispe" {
+						continue
+					}
+					data, err := readBoxData(r, property)
+					if err != nil {
+						return err
+					}
+					f := &fieldReader{data: data}
+					f.read(4)
+					width, height := int(f.uint(4)), int(f.uint(4))
+					if !f.short && width*height > md.Width*md.Height {
+						md.Width, md.Height = width, height
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findHEIFItemID finds the ID of the first item of the given type, or 0 if
+// there isn't one
+func findHEIFItemID(r io.ReaderAt, iinf *box, itemType string) (uint64, error) {
+	if iinf == nil {
+		return 0, nil
+	}
+	data, err := readBoxData(r, iinf)
+	if err != nil {
+		return 0, err
+	}
+	f := &fieldReader{data: data}
+	version := f.uint(1)
+	f.read(3)
+	entryCountSize := 2
+	if version != 0 {
+		entryCountSize = 4
+	}
+	f.uint(entryCountSize)
+	if f.short {
+		return 0, errors.New("iinf box too short")
+	}
+
+	infes, err := readBoxes(r, iinf.start+int64(f.offset), iinf.end)
+	if err != nil {
+		return 0, err
+	}
+	for _, infe := range infes {
+		if infe.typ != "infe" {
+			continue
+		}
+		data, err := readBoxData(r, infe)
+		if err != nil {
+			return 0, err
+		}
+		f := &fieldReader{data: data}
+		version := f.uint(1)
+		f.read(3)
+		if version < 2 {
+			// older versions don't have item types
+			continue
+		}
+		itemIDSize := 2
+		if version == 3 {
+			itemIDSize = 4
+		}
+		itemID := f.uint(itemIDSize)
+		f.read(2) // protection index
+		if string(f.read(4)) == itemType && !f.short {
+			return itemID, nil
+		}
+	}
+	return 0, nil
+}
+
+// readHEIFItem reads the data of an item using its location in the iloc box
+func readHEIFItem(r io.ReaderAt, iloc *box, itemID uint64) ([]byte, error) {
+	if iloc == nil {
+		return nil, errors.New("no iloc box")
+	}
+	data, err := readBoxData(r, iloc)
+	if err != nil {
+		return nil, err
+	}
+	f := &fieldReader{data: data}
+	version := f.uint(1)
+	f.read(3)
+	sizes := f.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0xF)
+	sizes = f.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), int(sizes&0xF)
+	if version == 0 {
+		indexSize = 0
+	}
+	itemCountSize := 2
+	if version == 2 {
+		itemCountSize = 4
+	}
+	itemCount := f.uint(itemCountSize)
+
+	for i := uint64(0); i < itemCount && !f.short; i++ {
+		currentItemID := f.uint(itemCountSize)
+		constructionMethod := uint64(0)
+		if version != 0 {
+			constructionMethod = f.uint(2) & 0xF
+		}
+		f.read(2) // data reference index
+		baseOffset := f.uint(baseOffsetSize)
+		extentCount := f.uint(2)
+
+		itemData := []byte{}
+		for j := uint64(0); j < extentCount && !f.short; j++ {
+			f.read(indexSize)
+			extentOffset := f.uint(offsetSize)
+			extentLength := f.uint(lengthSize)
+			if currentItemID != itemID {
+				continue
+			}
+			if constructionMethod != 0 {
+				return nil, errors.New("unsupported item construction method")
+			}
+			if extentLength > maxBoxReadSize-uint64(len(itemData)) {
+				return nil, errors.New("item is too big")
+			}
+			extent := make([]byte, extentLength)
+			if _, err := r.ReadAt(extent, int64(baseOffset+extentOffset)); err != nil {
+				return nil, err
+			}
+			itemData = append(itemData, extent...)
+		}
+		if currentItemID == itemID {
+			return itemData, nil
+		}
+	}
+	if f.short {
+		return nil, errors.New("iloc box too short")
+	}
+	return nil, fmt.Errorf("item %d not found", itemID)
+}
+
+// readMovie reads the creation time, size, camera and location of a MP4 or
+// MOV file
+func readMovie(r io.ReaderAt, moov *box, md *Metadata) error {
+	moovChildren, err := readChildren(r, moov, 0)
+	if err != nil {
+		return err
+	}
+
+	if mvhd := findBox(moovChildren, "mvhd"); mvhd != nil {
+		data, err := readBoxData(r, mvhd)
+		if err != nil {
+			return err
+		}
+		f := &fieldReader{data: data}
+		timeSize := 4
+		if f.uint(1) == 1 {
+			timeSize = 8
+		}
+		f.read(3)
+		creationSeconds := f.uint(timeSize)
+		if creationSeconds != 0 && !f.short {
+			md.CaptureTime = bmffEpoch.Add(time.Duration(creationSeconds) * time.Second)
+			md.CaptureTimeHasZone = true
+		}
+	}
+
+	for _, trak := range moovChildren {
+		if trak.typ != "trak" {
+			continue
+		}
+		trakChildren, err := readChildren(r, trak, 0)
+		if err != nil {
+			return err
+		}
+		tkhd := findBox(trakChildren, "tkhd")
+		if tkhd == nil {
+			continue
+		}
+		data, err := readBoxData(r, tkhd)
+		if err != nil {
+			return err
+		}
+		f := &fieldReader{data: data}
+		timeSize := 4
+		if f.uint(1) == 1 {
+			timeSize = 8
+		}
+		f.read(3)
+		// times, track ID, reserved, duration, reserved, layer, alternate
+		// group, volume, reserved and matrix
+		f.read(2*timeSize + 4 + 4 + timeSize + 8 + 2 + 2 + 2 + 2 + 36)
+		// width and height are 16.16 fixed point
+		width, height := int(f.uint(4)>>16), int(f.uint(4)>>16)
+		if !f.short && width*height > md.Width*md.Height {
+			md.Width, md.Height = width, height
+		}
+	}
+
+	if udta := findBox(moovChildren, "udta"); udta != nil {
+		if err := readUserData(r, udta, md); err != nil {
+			return err
+		}
+	}
+	if meta := findBox(moovChildren, "meta"); meta != nil {
+		if err := readQuickTimeMeta(r, meta, md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readUserData reads the camera and location from the udta box, where each
+// value is a 2 byte size, a 2 byte language and then the string
+func readUserData(r io.ReaderAt, udta *box, md *Metadata) error {
+	udtaChildren, err := readChildren(r, udta, 0)
+	if err != nil {
+		return err
+	}
+	for _, child := range udtaChildren {
+		switch child.typ {
+		case "\xa9mak", "\xa9mod", "\xa9xyz":
+		case "meta":
+			if err := readQuickTimeMeta(r, child, md); err != nil {
+				return err
+			}
+			continue
+		default:
+			continue
+		}
+		data, err := readBoxData(r, child)
+		if err != nil {
+			return err
+		}
+		f := &fieldReader{data: data}
+		size := int(f.uint(2))
+		f.read(2)
+		value := string(f.read(size))
+		if f.short {
+			continue
+		}
+		switch child.typ {
+		case "\xa9mak":
+			md.CameraMake = value
+		case "\xa9mod":
+			md.CameraModel = value
+		case "\xa9xyz":
+			setISO6709Location(md, value)
+		}
+	}
+	return nil
+}
+
+// readQuickTimeMeta reads the values of a meta box with keys and ilst boxes,
+// which is how Apple devices store the camera, location and creation date
+func readQuickTimeMeta(r io.ReaderAt, meta *box, md *Metadata) error {
+	// QuickTime meta boxes aren't full boxes, while MP4 ones are, so check
+	// whether the first child box is right after the header
+	skip := int64(4)
+	if meta.end-meta.start >= 8 {
+		typ := make([]byte, 4)
+		if _, err := r.ReadAt(typ, meta.start+4); err != nil {
+			return err
+		}
+		if string(typ) == "hdlr" {
+			skip = 0
+		}
+	}
+	metaChildren, err := readChildren(r, meta, skip)
+	if err != nil {
+		return err
+	}
+	keysBox := findBox(metaChildren, "keys")
+	ilst := findBox(metaChildren, "ilst")
+	if keysBox == nil || ilst == nil {
+		return nil
+	}
+
+	data, err := readBoxData(r, keysBox)
+	if err != nil {
+		return err
+	}
+	f := &fieldReader{data: data}
+	f.read(4)
+	keyCount := f.uint(4)
+	keys := []string{}
+	for i := uint64(0); i < keyCount && !f.short; i++ {
+		keySize := int(f.uint(4))
+		f.read(4) // namespace
+		keys = append(keys, string(f.read(keySize-8)))
+	}
+
+	items, err := readChildren(r, ilst, 0)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		// item types are the 1 based index of their key
+		keyIndex := int(binary.BigEndian.Uint32([]byte(item.typ))) - 1
+		if keyIndex < 0 || keyIndex >= len(keys) {
+			continue
+		}
+		itemChildren, err := readChildren(r, item, 0)
+		if err != nil {
+			return err
+		}
+		dataBox := findBox(itemChildren, "data")
+		if dataBox == nil {
+			continue
+		}
+		data, err := readBoxData(r, dataBox)
+		if err != nil {
+			return err
+		}
+		if len(data) < 8 {
+			continue
+		}
+		// skip the type and locale
+		value := string(data[8:])
+		switch keys[keyIndex] {
+		case "com.apple.quicktime.make":
+			md.CameraMake = value
+		case "com.apple.quicktime.model":
+			md.CameraModel = value
+		case "com.apple.quicktime.location.ISO6709":
+			setISO6709Location(md, value)
+		case "com.apple.quicktime.creationdate":
+			// this has the time zone, unlike the mvhd time which is UTC
+			if creationDate, err := time.Parse("2006-01-02T15:04:05-0700", value); err == nil {
+				md.CaptureTime = creationDate
+				md.CaptureTimeHasZone = true
+			}
+		}
+	}
+	return nil
+}
+
+func setISO6709Location(md *Metadata, location string) {
+	parts := iso6709Regex.FindStringSubmatch(location)
+	if parts == nil {
+		return
+	}
+	latitude, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return
+	}
+	longitude, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return
+	}
+	md.HasLocation = true
+	md.Latitude = latitude
+	md.Longitude = longitude
+}
@@ -0,0 +1,316 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// EXIF tags that get read
+const (
+	tagImageWidth         = 0x0100
+	tagImageHeight        = 0x0101
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagDateTime           = 0x0132
+	tagExposureTime       = 0x829A
+	tagFNumber            = 0x829D
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagISO                = 0x8827
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagFocalLength        = 0x920A
+	tagPixelXDimension    = 0xA002
+	tagPixelYDimension    = 0xA003
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+)
+
+// exifDateTimeFormat is how EXIF stores times
+const exifDateTimeFormat = "2006:01:02 15:04:05"
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// readJPEG reads the EXIF data, or failing that just the size, of a JPEG
+func readJPEG(r io.Reader, md *Metadata) error {
+	br := bufio.NewReader(r)
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(br, soi); err != nil {
+		return err
+	}
+
+	foundExif := false
+	for {
+		// markers are 0xFF followed by the marker byte, with any number of
+		// 0xFF fill bytes in between
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != 0xFF {
+			return fmt.Errorf("bad JPEG marker 0x%02X", b)
+		}
+		marker := byte(0xFF)
+		for marker == 0xFF {
+			if marker, err = br.ReadByte(); err != nil {
+				return err
+			}
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			// end of image or start of the image data, there is no metadata
+			// after either
+			return nil
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			// these markers have no data
+			continue
+		}
+
+		lengthBytes := make([]byte, 2)
+		if _, err := io.ReadFull(br, lengthBytes); err != nil {
+			return err
+		}
+		length := int(binary.BigEndian.Uint16(lengthBytes)) - 2
+		if length < 0 {
+			return errors.New("bad JPEG segment length")
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return err
+		}
+
+		switch {
+		case marker == 0xE1 && !foundExif && bytes.HasPrefix(segment, exifHeader):
+			if err := readTIFF(segment[len(exifHeader):], md); err != nil {
+				return err
+			}
+			foundExif = true
+		case isJPEGStartOfFrame(marker) && len(segment) >= 5 && (md.Width == 0 || md.Height == 0):
+			md.Height = int(binary.BigEndian.Uint16(segment[1:3]))
+			md.Width = int(binary.BigEndian.Uint16(segment[3:5]))
+		}
+	}
+}
+
+func isJPEGStartOfFrame(marker byte) bool {
+	return marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC
+}
+
+// tiffEntry is a single entry of a TIFF IFD
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// tiffTypeSizes is the size in bytes of a single value of each TIFF type
+var tiffTypeSizes = map[uint16]uint32{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	7:  1, // UNDEFINED
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+}
+
+// readIFD reads the entries of the IFD at the offset
+func (t *tiffReader) readIFD(offset uint32) (map[uint16]*tiffEntry, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, errors.New("IFD offset out of range")
+	}
+	numEntries := uint32(t.order.Uint16(t.data[offset:]))
+	if uint64(offset)+2+uint64(numEntries)*12 > uint64(len(t.data)) {
+		return nil, errors.New("IFD entries out of range")
+	}
+
+	entries := map[uint16]*tiffEntry{}
+	for i := uint32(0); i < numEntries; i++ {
+		entryBytes := t.data[offset+2+i*12 : offset+2+(i+1)*12]
+		entry := &tiffEntry{
+			typ:   t.order.Uint16(entryBytes[2:4]),
+			count: t.order.Uint32(entryBytes[4:8]),
+		}
+		typeSize, known := tiffTypeSizes[entry.typ]
+		if !known {
+			continue
+		}
+		size := uint64(typeSize) * uint64(entry.count)
+		if size <= 4 {
+			entry.value = entryBytes[8 : 8+size]
+		} else {
+			valueOffset := uint64(t.order.Uint32(entryBytes[8:12]))
+			if valueOffset+size > uint64(len(t.data)) {
+				continue
+			}
+			entry.value = t.data[valueOffset : valueOffset+size]
+		}
+		entries[t.order.Uint16(entryBytes[0:2])] = entry
+	}
+	return entries, nil
+}
+
+func (t *tiffReader) str(entry *tiffEntry) string {
+	if entry == nil || entry.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(entry.value), "\x00"))
+}
+
+func (t *tiffReader) uint(entry *tiffEntry) (uint32, bool) {
+	if entry == nil || entry.count == 0 {
+		return 0, false
+	}
+	switch entry.typ {
+	case 1, 7:
+		return uint32(entry.value[0]), true
+	case 3:
+		return uint32(t.order.Uint16(entry.value)), true
+	case 4, 9:
+		return t.order.Uint32(entry.value), true
+	}
+	return 0, false
+}
+
+func (t *tiffReader) rational(entry *tiffEntry, i uint32) (float64, bool) {
+	if entry == nil || i >= entry.count || (entry.typ != 5 && entry.typ != 10) {
+		return 0, false
+	}
+	value := entry.value[i*8:]
+	if entry.typ == 10 {
+		numerator := int32(t.order.Uint32(value[0:4]))
+		denominator := int32(t.order.Uint32(value[4:8]))
+		if denominator == 0 {
+			return 0, false
+		}
+		return float64(numerator) / float64(denominator), true
+	}
+	numerator := t.order.Uint32(value[0:4])
+	denominator := t.order.Uint32(value[4:8])
+	if denominator == 0 {
+		return 0, false
+	}
+	return float64(numerator) / float64(denominator), true
+}
+
+// readTIFF reads the EXIF metadata out of a TIFF structure, which is how EXIF
+// is stored in both JPEG and HEIC files
+func readTIFF(data []byte, md *Metadata) error {
+	if len(data) < 8 {
+		return errors.New("EXIF data too short")
+	}
+	t := &tiffReader{data: data}
+	switch string(data[0:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return errors.New("bad EXIF byte order")
+	}
+
+	ifd0, err := t.readIFD(t.order.Uint32(data[4:8]))
+	if err != nil {
+		return err
+	}
+	md.CameraMake = t.str(ifd0[tagMake])
+	md.CameraModel = t.str(ifd0[tagModel])
+	if width, ok := t.uint(ifd0[tagImageWidth]); ok {
+		md.Width = int(width)
+	}
+	if height, ok := t.uint(ifd0[tagImageHeight]); ok {
+		md.Height = int(height)
+	}
+
+	dateTime := t.str(ifd0[tagDateTime])
+	offsetTime := ""
+	if exifIFDOffset, ok := t.uint(ifd0[tagExifIFD]); ok {
+		exifIFD, err := t.readIFD(exifIFDOffset)
+		if err != nil {
+			return err
+		}
+		if dateTimeOriginal := t.str(exifIFD[tagDateTimeOriginal]); dateTimeOriginal != "" {
+			dateTime = dateTimeOriginal
+			offsetTime = t.str(exifIFD[tagOffsetTimeOriginal])
+		}
+		if width, ok := t.uint(exifIFD[tagPixelXDimension]); ok {
+			md.Width = int(width)
+		}
+		if height, ok := t.uint(exifIFD[tagPixelYDimension]); ok {
+			md.Height = int(height)
+		}
+		if iso, ok := t.uint(exifIFD[tagISO]); ok {
+			md.IsoEquivalent = int(iso)
+		}
+		md.ExposureTime, _ = t.rational(exifIFD[tagExposureTime], 0)
+		md.ApertureFNumber, _ = t.rational(exifIFD[tagFNumber], 0)
+		md.FocalLength, _ = t.rational(exifIFD[tagFocalLength], 0)
+	}
+	setExifCaptureTime(md, dateTime, offsetTime)
+
+	if gpsIFDOffset, ok := t.uint(ifd0[tagGPSIFD]); ok {
+		gpsIFD, err := t.readIFD(gpsIFDOffset)
+		if err != nil {
+			return err
+		}
+		latitude, latitudeOK := gpsCoordinate(t, gpsIFD[tagGPSLatitude], t.str(gpsIFD[tagGPSLatitudeRef]), "S")
+		longitude, longitudeOK := gpsCoordinate(t, gpsIFD[tagGPSLongitude], t.str(gpsIFD[tagGPSLongitudeRef]), "W")
+		if latitudeOK && longitudeOK {
+			md.HasLocation = true
+			md.Latitude = latitude
+			md.Longitude = longitude
+		}
+	}
+	return nil
+}
+
+// setExifCaptureTime parses an EXIF time, which only has a time zone if there
+// is also an offset time
+func setExifCaptureTime(md *Metadata, dateTime, offsetTime string) {
+	if dateTime == "" {
+		return
+	}
+	if offsetTime != "" {
+		captureTime, err := time.Parse(exifDateTimeFormat+"-07:00", dateTime+offsetTime)
+		if err == nil {
+			md.CaptureTime = captureTime
+			md.CaptureTimeHasZone = true
+			return
+		}
+	}
+	captureTime, err := time.ParseInLocation(exifDateTimeFormat, dateTime, time.Local)
+	if err == nil {
+		md.CaptureTime = captureTime
+	}
+}
+
+// gpsCoordinate converts degrees, minutes and seconds into decimal degrees,
+// negative when the ref is negativeRef
+func gpsCoordinate(t *tiffReader, entry *tiffEntry, ref, negativeRef string) (float64, bool) {
+	degrees, ok := t.rational(entry, 0)
+	if !ok {
+		return 0, false
+	}
+	minutes, _ := t.rational(entry, 1)
+	seconds, _ := t.rational(entry, 2)
+	coordinate := degrees + minutes/60 + seconds/3600
+	if ref == negativeRef {
+		coordinate = -coordinate
+	}
+	return coordinate, true
+}
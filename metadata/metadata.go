@@ -0,0 +1,117 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jastribl/photosync/photos"
+)
+
+// ErrUnsupported is returned for files that aren't a JPEG, HEIC, MP4 or MOV
+var ErrUnsupported = errors.New("unsupported file type")
+
+// Metadata is what could be read from a local photo or video. Anything that
+// isn't in the file is left as the zero value.
+type Metadata struct {
+	IsVideo bool
+
+	// CaptureTime is when the photo or video was taken
+	CaptureTime time.Time
+	// CaptureTimeHasZone is false when the file only has a local time without
+	// a time zone, in which case CaptureTime is in the local time zone
+	CaptureTimeHasZone bool
+
+	CameraMake  string
+	CameraModel string
+	Width       int
+	Height      int
+
+	HasLocation bool
+	Latitude    float64
+	Longitude   float64
+
+	// Photo only settings
+	FocalLength     float64
+	ApertureFNumber float64
+	IsoEquivalent   int
+	// ExposureTime is in seconds
+	ExposureTime float64
+}
+
+// ReadFile reads the metadata of the photo or video at the path
+func ReadFile(path string) (*Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	md, err := Read(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata of '%s': %s", path, err.Error())
+	}
+	return md, nil
+}
+
+// Read reads the metadata of a photo or video, working out the file type from
+// its first bytes
+func Read(r io.ReaderAt, size int64) (*Metadata, error) {
+	header := make([]byte, 12)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	md := &Metadata{}
+	switch {
+	case len(header) >= 2 && header[0] == 0xFF && header[1] == 0xD8:
+		err = readJPEG(io.NewSectionReader(r, 0, size), md)
+	case len(header) >= 8 && isBMFFBoxType(string(header[4:8])):
+		err = readBMFF(r, size, md)
+	default:
+		err = ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// ToMediaMetadata maps the metadata onto the fields that Google Photos gives
+// for a media item, so local files and media items can be compared
+func (md *Metadata) ToMediaMetadata() *photos.MediaMetadata {
+	mediaMetadata := &photos.MediaMetadata{}
+	if !md.CaptureTime.IsZero() {
+		mediaMetadata.CreationTime = md.CaptureTime.UTC().Format(time.RFC3339)
+	}
+	if md.Width > 0 && md.Height > 0 {
+		mediaMetadata.Width = strconv.Itoa(md.Width)
+		mediaMetadata.Height = strconv.Itoa(md.Height)
+	}
+	if md.IsVideo {
+		mediaMetadata.Video = &photos.Video{
+			CameraMake:  md.CameraMake,
+			CameraModel: md.CameraModel,
+		}
+		return mediaMetadata
+	}
+	mediaMetadata.Photo = &photos.Photo{
+		CameraMake:      md.CameraMake,
+		CameraModel:     md.CameraModel,
+		FocalLength:     md.FocalLength,
+		ApertureFNumber: md.ApertureFNumber,
+		IsoEquivalent:   md.IsoEquivalent,
+	}
+	if md.ExposureTime > 0 {
+		mediaMetadata.Photo.ExposureTime = strconv.FormatFloat(md.ExposureTime, 'f', -1, 64) + "s"
+	}
+	return mediaMetadata
+}
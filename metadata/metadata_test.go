@@ -0,0 +1,236 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// tiffField is an IFD entry for building test TIFF data
+type tiffField struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// buildTIFF builds big endian TIFF data with an IFD0 and an optional Exif IFD,
+// putting values that don't fit in an entry after the IFDs
+func buildTIFF(ifd0, exifIFD []tiffField) []byte {
+	ifdSize := func(fields []tiffField) int { return 2 + 12*len(fields) + 4 }
+	ifd0Offset := 8
+	exifOffset := ifd0Offset + ifdSize(ifd0)
+	if exifIFD != nil {
+		ifd0 = append(ifd0, tiffField{tagExifIFD, 4, 1, u32(uint32(exifOffset + 12))})
+		exifOffset += 12
+	}
+	valuesOffset := exifOffset
+	if exifIFD != nil {
+		valuesOffset += ifdSize(exifIFD)
+	}
+
+	data := []byte("MM\x00\x2a")
+	data = append(data, u32(uint32(ifd0Offset))...)
+	values := []byte{}
+	writeIFD := func(fields []tiffField) {
+		data = append(data, u16(uint16(len(fields)))...)
+		for _, field := range fields {
+			data = append(data, u16(field.tag)...)
+			data = append(data, u16(field.typ)...)
+			data = append(data, u32(field.count)...)
+			if len(field.value) <= 4 {
+				data = append(data, append(field.value, make([]byte, 4-len(field.value))...)...)
+			} else {
+				data = append(data, u32(uint32(valuesOffset+len(values)))...)
+				values = append(values, field.value...)
+			}
+		}
+		data = append(data, u32(0)...)
+	}
+	writeIFD(ifd0)
+	if exifIFD != nil {
+		writeIFD(exifIFD)
+	}
+	return append(data, values...)
+}
+
+func asciiField(tag uint16, value string) tiffField {
+	return tiffField{tag, 2, uint32(len(value) + 1), append([]byte(value), 0)}
+}
+
+func u16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+// jpegSegment builds a JPEG segment with its marker and length
+func jpegSegment(marker byte, data []byte) []byte {
+	return append(append([]byte{0xFF, marker}, u16(uint16(len(data)+2))...), data...)
+}
+
+func buildJPEG(segments ...[]byte) []byte {
+	jpeg := []byte{0xFF, 0xD8}
+	for _, segment := range segments {
+		jpeg = append(jpeg, segment...)
+	}
+	return append(jpeg, 0xFF, 0xD9)
+}
+
+// bmffBox builds a box with a 32 bit size
+func bmffBox(typ string, children ...[]byte) []byte {
+	data := bytes.Join(children, nil)
+	return append(append(u32(uint32(8+len(data))), typ...), data...)
+}
+
+// quickTimeMeta builds a QuickTime meta box with one key whose entry has the
+// given size, and an ilst value for it
+func quickTimeMeta(keySize uint32, key, value string) []byte {
+	keys := append(u32(0), u32(1)...)
+	keys = append(keys, u32(keySize)...)
+	keys = append(keys, "mdta"...)
+	keys = append(keys, key...)
+	dataBox := bmffBox("data", append(append(u32(1), u32(0)...), value...))
+	item := append(append(u32(uint32(8+len(dataBox))), u32(1)...), dataBox...)
+	return bmffBox("meta", bmffBox("hdlr", make([]byte, 24)), bmffBox("keys", keys), bmffBox("ilst", item))
+}
+
+func buildMOV(moovChildren ...[]byte) []byte {
+	ftyp := bmffBox("ftyp", []byte("qt  \x00\x00\x00\x00qt  "))
+	return append(ftyp, bmffBox("moov", moovChildren...)...)
+}
+
+func readBytes(t *testing.T, data []byte) (*Metadata, error) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("panicked reading %d bytes: %v", len(data), r)
+		}
+	}()
+	return Read(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestReadJPEG(t *testing.T) {
+	tiff := buildTIFF(
+		[]tiffField{asciiField(tagMake, "Apple"), asciiField(tagModel, "iPhone 12")},
+		[]tiffField{
+			asciiField(tagDateTimeOriginal, "2021:06:05 14:03:02"),
+			asciiField(tagOffsetTimeOriginal, "-07:00"),
+			{tagPixelXDimension, 4, 1, u32(4032)},
+			{tagPixelYDimension, 4, 1, u32(3024)},
+		},
+	)
+	jpeg := buildJPEG(jpegSegment(0xE1, append(append([]byte{}, exifHeader...), tiff...)))
+
+	md, err := readBytes(t, jpeg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.CameraMake != "Apple" || md.CameraModel != "iPhone 12" {
+		t.Errorf("got camera %q %q", md.CameraMake, md.CameraModel)
+	}
+	if md.Width != 4032 || md.Height != 3024 {
+		t.Errorf("got size %dx%d", md.Width, md.Height)
+	}
+	want := time.Date(2021, 6, 5, 21, 3, 2, 0, time.UTC)
+	if !md.CaptureTime.Equal(want) || !md.CaptureTimeHasZone {
+		t.Errorf("got capture time %s (has zone %t), want %s", md.CaptureTime, md.CaptureTimeHasZone, want)
+	}
+}
+
+func TestReadJPEGStartOfFrameSize(t *testing.T) {
+	sof := append([]byte{8}, append(u16(480), u16(640)...)...)
+	md, err := readBytes(t, buildJPEG(jpegSegment(0xC0, append(sof, 3))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Width != 640 || md.Height != 480 {
+		t.Errorf("got size %dx%d", md.Width, md.Height)
+	}
+}
+
+func TestReadTIFFBadOffsets(t *testing.T) {
+	tests := map[string][]byte{
+		"IFD0 past the end":    append([]byte("MM\x00\x2a"), u32(0xFFFFFFF0)...),
+		"entries past the end": append(append([]byte("MM\x00\x2a"), u32(8)...), u16(0xFFFF)...),
+	}
+	for name, tiff := range tests {
+		if err := readTIFF(tiff, &Metadata{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// a value pointing past the end is skipped rather than failing
+	tiff := buildTIFF([]tiffField{asciiField(tagModel, "Pixel 5")}, nil)
+	binary.BigEndian.PutUint32(tiff[8+2+8:], 0xFFFFFFF0)
+	md := &Metadata{}
+	if err := readTIFF(tiff, md); err != nil {
+		t.Fatal(err)
+	}
+	if md.CameraModel != "" {
+		t.Errorf("got model %q from a bad offset", md.CameraModel)
+	}
+}
+
+func TestReadMOV(t *testing.T) {
+	key := "com.apple.quicktime.model"
+	mov := buildMOV(quickTimeMeta(uint32(8+len(key)), key, "iPhone 12"))
+	md, err := readBytes(t, mov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.IsVideo || md.CameraModel != "iPhone 12" {
+		t.Errorf("got video %t model %q", md.IsVideo, md.CameraModel)
+	}
+}
+
+func TestReadMOVBadKeySizes(t *testing.T) {
+	key := "com.apple.quicktime.model"
+	for _, keySize := range []uint32{0, 4, 7, 0xFFFFFFFF, 0x7FFFFFFF} {
+		md, err := readBytes(t, buildMOV(quickTimeMeta(keySize, key, "iPhone 12")))
+		if err != nil {
+			continue
+		}
+		if md.CameraModel != "" {
+			t.Errorf("key size %d: got model %q", keySize, md.CameraModel)
+		}
+	}
+}
+
+func TestReadBMFFBadBoxSizes(t *testing.T) {
+	ftyp := bmffBox("ftyp", []byte("qt  \x00\x00\x00\x00"))
+	tests := map[string][]byte{
+		"size past the end":     append(ftyp, append(u32(0x7FFFFFFF), "moov"...)...),
+		"size under the header": append(ftyp, append(u32(4), "moov"...)...),
+		"huge 64 bit size":      append(ftyp, append(append(u32(1), "moov"...), 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xF0)...),
+	}
+	for name, data := range tests {
+		if _, err := readBytes(t, data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	key := "com.apple.quicktime.model"
+	tiff := buildTIFF(
+		[]tiffField{asciiField(tagModel, "iPhone 12")},
+		[]tiffField{asciiField(tagDateTimeOriginal, "2021:06:05 14:03:02")},
+	)
+	files := map[string][]byte{
+		"jpeg": buildJPEG(jpegSegment(0xE1, append(append([]byte{}, exifHeader...), tiff...))),
+		"mov":  buildMOV(quickTimeMeta(uint32(8+len(key)), key, "iPhone 12")),
+	}
+	for _, data := range files {
+		for n := 0; n < len(data); n++ {
+			readBytes(t, data[:n])
+		}
+	}
+}
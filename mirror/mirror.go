@@ -0,0 +1,152 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jastribl/photosync/files"
+)
+
+// DefaultDepth is the folder depth mirrored when the config doesn't set one,
+// making an album for each top level folder
+const DefaultDepth = 1
+
+// FolderAt gets the folder at the depth that a file's path (relative to the
+// root dir, using forward slashes) is in, or "" if the file isn't that deep
+func FolderAt(relPath string, depth int) string {
+	parts := strings.Split(relPath, "/")
+	if len(parts) <= depth {
+		return ""
+	}
+	return strings.Join(parts[:depth], "/")
+}
+
+// GroupByFolder groups the local files by their folder at the depth, returning
+// the folders in order and the files that aren't in any folder that deep
+func GroupByFolder(localFiles []*files.LocalFile, depth int) ([]string, map[string][]*files.LocalFile, []*files.LocalFile) {
+	folders := []string{}
+	filesByFolder := map[string][]*files.LocalFile{}
+	loose := []*files.LocalFile{}
+	for _, localFile := range localFiles {
+		folder := FolderAt(localFile.RelPath, depth)
+		if folder == "" {
+			loose = append(loose, localFile)
+			continue
+		}
+		if _, found := filesByFolder[folder]; !found {
+			folders = append(folders, folder)
+		}
+		filesByFolder[folder] = append(filesByFolder[folder], localFile)
+	}
+	sort.Strings(folders)
+	return folders, filesByFolder, loose
+}
+
+// Entry maps a local folder to the album mirroring it
+type Entry struct {
+	// Folder is relative to the root picture dir, using forward slashes
+	Folder     string `json:"folder"`
+	AlbumID    string `json:"albumId"`
+	AlbumTitle string `json:"albumTitle"`
+}
+
+// Mapping is the saved mapping from local folders to albums, which keeps a
+// folder on the same album when either of them is renamed. Folders are only
+// meaningful for the root dir and depth the mapping was made with.
+type Mapping struct {
+	path            string
+	root            string
+	depth           int
+	entriesByFolder map[string]*Entry
+}
+
+type mappingFile struct {
+	Root    string   `json:"root"`
+	Depth   int      `json:"depth"`
+	Entries []*Entry `json:"entries"`
+}
+
+// LoadMapping reads the mapping at the path, which doesn't need to exist yet,
+// for mirroring the folders at the depth under the root dir. It fails if the
+// mapping was made for another root dir or depth, as its folders would then
+// be different folders. A mapping saved before the root dir and depth were
+// kept is taken to be for this root dir and depth.
+func LoadMapping(path string, root string, depth int) (*Mapping, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	m := &Mapping{path: path, root: root, depth: depth, entriesByFolder: map[string]*Entry{}}
+	mappingJSON, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	saved := &mappingFile{Root: root, Depth: depth}
+	if trimmed := bytes.TrimSpace(mappingJSON); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(mappingJSON, &saved.Entries)
+	} else {
+		err = json.Unmarshal(mappingJSON, saved)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if saved.Root != root || saved.Depth != depth {
+		return nil, fmt.Errorf(
+			"%s is for the folders at depth %d under '%s', not depth %d under '%s'",
+			path,
+			saved.Depth,
+			saved.Root,
+			depth,
+			root,
+		)
+	}
+	for _, entry := range saved.Entries {
+		m.entriesByFolder[entry.Folder] = entry
+	}
+	return m, nil
+}
+
+// Get gets the entry for a folder, or nil if it isn't mapped
+func (m *Mapping) Get(folder string) *Entry {
+	return m.entriesByFolder[folder]
+}
+
+// Put maps a folder to an album, replacing any album it was mapped to
+func (m *Mapping) Put(entry *Entry) {
+	m.entriesByFolder[entry.Folder] = entry
+}
+
+// Remove drops the entry for a folder
+func (m *Mapping) Remove(folder string) {
+	delete(m.entriesByFolder, folder)
+}
+
+// Entries gets all the entries, sorted by folder
+func (m *Mapping) Entries() []*Entry {
+	entries := []*Entry{}
+	for _, entry := range m.entriesByFolder {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Folder < entries[j].Folder
+	})
+	return entries
+}
+
+// Save writes the mapping
+func (m *Mapping) Save() error {
+	mappingJSON, err := json.MarshalIndent(&mappingFile{Root: m.root, Depth: m.depth, Entries: m.Entries()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(m.path, mappingJSON, 0644)
+}
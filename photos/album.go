@@ -30,6 +30,14 @@ func (m *Client) CreateAlbum(title string) (*Album, error) {
 	if err != nil {
 		return nil, err
 	}
+	cache, err := m.Cache()
+	if err != nil {
+		return nil, err
+	}
+	err = cache.PutAlbum(response, time.Now())
+	if err != nil {
+		return nil, err
+	}
 	return response, nil
 }
 
@@ -71,11 +79,96 @@ func (m *Client) GetAllAlbums() ([]*Album, error) {
 	return allAlbums, nil
 }
 
-func (m *Client) GetAlbumWithTitle(title string) (*Album, error) {
+// RefreshAlbumsCache re-fetches all albums into the cache, along with the
+// media items of every album if withMediaItems is set
+func (m *Client) RefreshAlbumsCache(withMediaItems bool) ([]*Album, error) {
+	cache, err := m.Cache()
+	if err != nil {
+		return nil, err
+	}
+
+	fetchedAt := time.Now()
 	albums, err := m.GetAllAlbums()
 	if err != nil {
 		return nil, err
 	}
+	err = cache.ReplaceAllAlbums(albums, fetchedAt)
+	if err != nil {
+		return nil, err
+	}
+	m.albumsRefreshed = true
+	syncInfo, err := cache.GetSyncInfo()
+	if err != nil {
+		return nil, err
+	}
+	syncInfo.LastAlbumsSync = fetchedAt
+	err = cache.SetSyncInfo(syncInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	if withMediaItems {
+		for _, album := range albums {
+			log.Printf("Caching media items for album '%s'\n", album.Title)
+			if _, err := m.cacheAndReturnAllMediaItemsForAlbum(album); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return albums, nil
+}
+
+// GetAllAlbumsWithCache gets all albums from the cache, only fetching them if
+// they have never been cached
+func (m *Client) GetAllAlbumsWithCache() ([]*Album, error) {
+	cache, err := m.Cache()
+	if err != nil {
+		return nil, err
+	}
+	syncInfo, err := cache.GetSyncInfo()
+	if err != nil {
+		return nil, err
+	}
+	if syncInfo.LastAlbumsSync.IsZero() {
+		return m.RefreshAlbumsCache(false)
+	}
+
+	cachedAlbums, err := cache.GetAllCachedAlbums()
+	if err != nil {
+		return nil, err
+	}
+	albums := []*Album{}
+	for _, cachedAlbum := range cachedAlbums {
+		albums = append(albums, cachedAlbum.Album)
+	}
+	return albums, nil
+}
+
+// GetAlbumWithTitle finds an album by title in the cache, refreshing the
+// cached albums if there is no such album and they haven't already been
+// refreshed by this client. Albums created by this client are cached when they
+// are created, so they are still found.
+func (m *Client) GetAlbumWithTitle(title string) (*Album, error) {
+	albums, err := m.GetAllAlbumsWithCache()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, album := range albums {
+		if album.Title == title {
+			return album, nil
+		}
+	}
+
+	if m.albumsRefreshed {
+		return nil, nil
+	}
+	log.Printf("Album '%s' not found in cache, refreshing albums\n", title)
+	albums, err = m.RefreshAlbumsCache(false)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, album := range albums {
 		if album.Title == title {
@@ -86,6 +179,116 @@ func (m *Client) GetAlbumWithTitle(title string) (*Album, error) {
 	return nil, nil
 }
 
+// forgetCachedAlbumMediaItems drops the cached media items of an album that is
+// about to be changed so that they are re-fetched the next time they are needed
+func (m *Client) forgetCachedAlbumMediaItems(albumID string) error {
+	cache, err := m.Cache()
+	if err != nil {
+		return err
+	}
+	return cache.SetAlbumMediaItems(albumID, nil, time.Time{})
+}
+
+// maxBatchAddSize is the most media items that albums:batchAddMediaItems and
+// albums:batchRemoveMediaItems accept in a single request
+const maxBatchAddSize = 50
+
+type BatchAddMediaItemsRequest struct {
+	MediaItemIds []string `json:"mediaItemIds"`
+}
+
+type BatchAddMediaItemsResponse struct {
+	Error *ErrorResponse `json:"error"`
+}
+
+// BatchAddMediaItemsToAlbum adds existing library media items to an album.
+// Note that the API only allows adding to albums created by this app.
+func (m *Client) BatchAddMediaItemsToAlbum(albumID string, mediaItemIDs []string) error {
+	err := m.forgetCachedAlbumMediaItems(albumID)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(mediaItemIDs); start += maxBatchAddSize {
+		end := start + maxBatchAddSize
+		if end > len(mediaItemIDs) {
+			end = len(mediaItemIDs)
+		}
+
+		request := BatchAddMediaItemsRequest{
+			MediaItemIds: mediaItemIDs[start:end],
+		}
+		err := m.retryOnQuotaErrors(func() (*ErrorResponse, error) {
+			response := &BatchAddMediaItemsResponse{}
+			err := m.postJson(
+				fmt.Sprintf("https://photoslibrary.googleapis.com/v1/albums/%s:batchAddMediaItems", albumID),
+				request,
+				response,
+			)
+			return response.Error, err
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Added batch of %d media items to album\n", end-start)
+	}
+
+	return nil
+}
+
+type BatchRemoveMediaItemsRequest struct {
+	MediaItemIds []string `json:"mediaItemIds"`
+}
+
+type BatchRemoveMediaItemsResponse struct {
+	Error *ErrorResponse `json:"error"`
+}
+
+// BatchRemoveMediaItemsFromAlbum removes media items from an album. The media
+// items stay in the library. onRemoved is called with the IDs of each batch as
+// soon as it is removed, so callers know what was removed even if a later
+// batch fails. Note that the API only allows removing from albums created by
+// this app.
+func (m *Client) BatchRemoveMediaItemsFromAlbum(
+	albumID string,
+	mediaItemIDs []string,
+	onRemoved func(removedIDs []string) error,
+) error {
+	err := m.forgetCachedAlbumMediaItems(albumID)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(mediaItemIDs); start += maxBatchAddSize {
+		end := start + maxBatchAddSize
+		if end > len(mediaItemIDs) {
+			end = len(mediaItemIDs)
+		}
+
+		request := BatchRemoveMediaItemsRequest{
+			MediaItemIds: mediaItemIDs[start:end],
+		}
+		err := m.retryOnQuotaErrors(func() (*ErrorResponse, error) {
+			response := &BatchRemoveMediaItemsResponse{}
+			err := m.postJson(
+				fmt.Sprintf("https://photoslibrary.googleapis.com/v1/albums/%s:batchRemoveMediaItems", albumID),
+				request,
+				response,
+			)
+			return response.Error, err
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Removed batch of %d media items from album\n", end-start)
+		if err := onRemoved(mediaItemIDs[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type AlbumPosition struct {
 	Position                 string `json:"position,omitempty"`
 	RelativeEnrichmentItemId string `json:"relativeEnrichmentItemId,omitempty"`
@@ -138,48 +341,55 @@ func (m *Client) AddTextEnrichmentToAlbum(
 		position = "AFTER_MEDIA_ITEM"
 	}
 
-	for sleepSeconds := 1; ; sleepSeconds *= 2 {
-		if sleepSeconds > 10 {
-			sleepSeconds = 10
-		}
-		request := AddEnrichmentToAlbumRequest{
-			NewEnrichmentItem: &NewEnrichmentItem{
-				TextEnrichment: &TextEnrichment{
-					Text: labelText,
-				},
-			},
-			AlbumPosition: &AlbumPosition{
-				Position: position,
+	albumPosition := &AlbumPosition{
+		Position: position,
+	}
+	if afterMediaItem != nil {
+		albumPosition.RelativeMediaItemId = afterMediaItem.ID
+	}
+	return m.addTextEnrichment(albumID, albumPosition, labelText)
+}
+
+// AddTextEnrichmentToAlbumAfterEnrichment adds a text label to an album right
+// after another enrichment, like an earlier label
+func (m *Client) AddTextEnrichmentToAlbumAfterEnrichment(
+	albumID string,
+	afterEnrichmentID string,
+	labelText string,
+) (*AddEnrichmentResponse, error) {
+	return m.addTextEnrichment(albumID, &AlbumPosition{
+		Position:                 "AFTER_ENRICHMENT_ITEM",
+		RelativeEnrichmentItemId: afterEnrichmentID,
+	}, labelText)
+}
+
+func (m *Client) addTextEnrichment(
+	albumID string,
+	albumPosition *AlbumPosition,
+	labelText string,
+) (*AddEnrichmentResponse, error) {
+	request := AddEnrichmentToAlbumRequest{
+		NewEnrichmentItem: &NewEnrichmentItem{
+			TextEnrichment: &TextEnrichment{
+				Text: labelText,
 			},
-		}
-		if afterMediaItem != nil {
-			request.AlbumPosition.RelativeMediaItemId = afterMediaItem.ID
-		}
-		response := &AddEnrichmentResponse{}
+		},
+		AlbumPosition: albumPosition,
+	}
+	var response *AddEnrichmentResponse
+	err := m.retryOnQuotaErrors(func() (*ErrorResponse, error) {
+		response = &AddEnrichmentResponse{}
 		err := m.postJson(
 			fmt.Sprintf("https://photoslibrary.googleapis.com/v1/albums/%s:addEnrichment", albumID),
 			request,
 			response,
 		)
-		if err != nil {
-			return nil, err
-		}
-		if response.Error == nil {
-			return response, nil
-		}
-		if response.Error.Status == "RESOURCE_EXHAUSTED" {
-			// this means we need to retry after some time
-			log.Println("Hit API Quota Limit, retrying after a short sleep...")
-			time.Sleep(time.Duration(sleepSeconds) * time.Second)
-			continue
-		}
-
-		return nil, fmt.Errorf(
-			"got an error other than resource exhausted: %s - %s",
-			response.Error.Message,
-			response.Error.Status,
-		)
+		return response.Error, err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return response, nil
 }
 
 type EnrichmentItem struct {
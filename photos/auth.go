@@ -0,0 +1,368 @@
+package photos
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	urlApi "net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jastribl/photosync/config"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// AuthFlowBrowser opens the auth page in a browser (or prints the link if
+	// there is no browser) and gets the code through a loopback listener
+	AuthFlowBrowser = "browser"
+	// AuthFlowPaste prints the auth page link and reads the code, or the whole
+	// URL that the browser got redirected to, from stdin
+	AuthFlowPaste = "paste"
+	// AuthFlowDevice uses the OAuth device flow, where the user enters a short
+	// code on another device
+	AuthFlowDevice = "device"
+)
+
+// HasToken returns if the user has a token
+func HasToken(cfg *config.Config) bool {
+	_, err := tokenFromFile(cfg)
+	return err == nil
+}
+
+// Retrieves a token from a local file.
+func tokenFromFile(cfg *config.Config) (*oauth2.Token, error) {
+	f, err := os.Open(cfg.TokenFileLocation)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tok := &oauth2.Token{}
+	err = json.NewDecoder(f).Decode(tok)
+	return tok, err
+}
+
+// SaveToken saves a token given a config
+func SaveToken(cfg *config.Config, token *oauth2.Token) error {
+	f, err := os.OpenFile(cfg.TokenFileLocation, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Fatalf("Unable to cache oauth token: %v", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(token)
+}
+
+// GetAuthConfig returns a new auth config
+func GetAuthConfig(cfg *config.Config) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Scopes:       cfg.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  cfg.AuthURL,
+			TokenURL: cfg.TokenURL,
+		},
+		RedirectURL: getRedirectURL(cfg),
+	}
+}
+
+// persistingTokenSource is a token source that saves tokens whenever they
+// change, and that re-runs the auth flow if the refresh token gets revoked
+type persistingTokenSource struct {
+	cfg       *config.Config
+	mu        sync.Mutex
+	source    oauth2.TokenSource
+	lastToken *oauth2.Token
+}
+
+func newPersistingTokenSource(cfg *config.Config, tok *oauth2.Token) *persistingTokenSource {
+	return &persistingTokenSource{
+		cfg:       cfg,
+		source:    GetAuthConfig(cfg).TokenSource(context.Background(), tok),
+		lastToken: tok,
+	}
+}
+
+// isInvalidGrant returns if the error means the refresh token is no longer
+// valid, e.g. because access was revoked or it expired
+func isInvalidGrant(err error) bool {
+	var retrieveError *oauth2.RetrieveError
+	return errors.As(err, &retrieveError) && strings.Contains(string(retrieveError.Body), "invalid_grant")
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tok, err := s.source.Token()
+	if err != nil {
+		if !isInvalidGrant(err) {
+			return nil, err
+		}
+		log.Println("The saved token is no longer valid, authenticating again")
+		tok, err = getTokenFromUser(s.cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.source = GetAuthConfig(s.cfg).TokenSource(context.Background(), tok)
+	}
+
+	if s.lastToken == nil ||
+		tok.AccessToken != s.lastToken.AccessToken ||
+		tok.RefreshToken != s.lastToken.RefreshToken {
+		if err := SaveToken(s.cfg, tok); err != nil {
+			return nil, err
+		}
+		s.lastToken = tok
+	}
+
+	return tok, nil
+}
+
+// getRedirectURL gets the configured redirect URL, with the port swapped out
+// for the auth listen port if there is one
+func getRedirectURL(cfg *config.Config) string {
+	if cfg.AuthListenPort == 0 {
+		return cfg.RedirectURL
+	}
+	redirectURL, err := urlApi.Parse(cfg.RedirectURL)
+	if err != nil {
+		return cfg.RedirectURL
+	}
+	redirectURL.Host = net.JoinHostPort(redirectURL.Hostname(), strconv.Itoa(cfg.AuthListenPort))
+	return redirectURL.String()
+}
+
+// getTokenFromUser runs the configured auth flow to get a new token
+func getTokenFromUser(cfg *config.Config) (*oauth2.Token, error) {
+	switch cfg.AuthFlow {
+	case "", AuthFlowBrowser:
+		return getTokenWithLoopbackListener(cfg)
+	case AuthFlowPaste:
+		return getTokenWithPastedCode(cfg)
+	case AuthFlowDevice:
+		return getTokenWithDeviceFlow(cfg)
+	default:
+		return nil, fmt.Errorf(
+			"unknown auth flow '%s', must be one of: %s, %s, %s",
+			cfg.AuthFlow,
+			AuthFlowBrowser,
+			AuthFlowPaste,
+			AuthFlowDevice,
+		)
+	}
+}
+
+func newAuthState() (string, error) {
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(stateBytes), nil
+}
+
+// openBrowser tries to open the url in a browser, returning an error if there
+// doesn't seem to be one
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return errors.New("no display found")
+		}
+		return exec.Command("xdg-open", url).Start()
+	}
+}
+
+func getTokenWithLoopbackListener(cfg *config.Config) (*oauth2.Token, error) {
+	oauthConfig := GetAuthConfig(cfg)
+	state, err := newAuthState()
+	if err != nil {
+		return nil, err
+	}
+	redirectURL, err := urlApi.Parse(oauthConfig.RedirectURL)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", redirectURL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	type codeResult struct {
+		code string
+		err  error
+	}
+	codeResults := make(chan codeResult, 1)
+	sendCodeResult := func(result codeResult) {
+		// only the first result is used, don't block on any later ones
+		select {
+		case codeResults <- result:
+		default:
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirectURL.Path, func(w http.ResponseWriter, r *http.Request) {
+		queryParts := r.URL.Query()
+		if queryParts.Get("state") != state {
+			http.Error(w, "Invalid state", http.StatusBadRequest)
+			return
+		}
+		if authError := queryParts.Get("error"); authError != "" {
+			fmt.Fprintf(w, "<p><strong>Error:</strong> %s</p>", authError)
+			sendCodeResult(codeResult{err: fmt.Errorf("auth failed: %s", authError)})
+			return
+		}
+
+		// show succes page
+		msg := "<p><strong>Success!</strong></p>"
+		msg = msg + "<p>You are authenticated and can now return to the CLI.</p>"
+		fmt.Fprint(w, msg)
+
+		sendCodeResult(codeResult{code: queryParts.Get("code")})
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	url := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
+	if err := openBrowser(url); err != nil {
+		fmt.Printf("Unable to open a browser (%s), open this link to authenticate:\n%s\n", err.Error(), url)
+		fmt.Printf("If the browser is on another machine, forward %s to this one first (e.g. ssh -L)\n", redirectURL.Host)
+	}
+
+	result := <-codeResults
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	// Exchange will do the handshake to retrieve the initial access token.
+	return oauthConfig.Exchange(context.Background(), result.code)
+}
+
+func getTokenWithPastedCode(cfg *config.Config) (*oauth2.Token, error) {
+	oauthConfig := GetAuthConfig(cfg)
+	state, err := newAuthState()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Open this link in any browser to authenticate:\n%s\n", oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline))
+	fmt.Println("The browser will then fail to load a page, copy the URL it was sent to (or just the code in it) and paste it here:")
+	input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	code := strings.TrimSpace(input)
+	if pastedURL, err := urlApi.Parse(code); err == nil && pastedURL.Query().Get("code") != "" {
+		if pastedURL.Query().Get("state") != state {
+			return nil, errors.New("pasted URL has the wrong state, make sure it's from the latest link")
+		}
+		code = pastedURL.Query().Get("code")
+	}
+
+	// Exchange will do the handshake to retrieve the initial access token.
+	return oauthConfig.Exchange(context.Background(), code)
+}
+
+type deviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	Error           string `json:"error"`
+}
+
+type deviceTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+}
+
+func getTokenWithDeviceFlow(cfg *config.Config) (*oauth2.Token, error) {
+	resp, err := http.PostForm(cfg.DeviceAuthURL, urlApi.Values{
+		"client_id": {cfg.ClientID},
+		"scope":     {strings.Join(cfg.Scopes, " ")},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	deviceCode := &deviceCodeResponse{}
+	err = json.NewDecoder(resp.Body).Decode(deviceCode)
+	if err != nil {
+		return nil, err
+	}
+	if deviceCode.Error != "" {
+		return nil, fmt.Errorf("error getting device code: %s", deviceCode.Error)
+	}
+
+	fmt.Printf("Go to %s on any device and enter the code: %s\n", deviceCode.VerificationURL, deviceCode.UserCode)
+
+	interval := time.Duration(deviceCode.Interval) * time.Second
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(deviceCode.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		tok, err := pollDeviceToken(cfg, deviceCode.DeviceCode)
+		if err != nil {
+			return nil, err
+		}
+		switch tok.Error {
+		case "":
+			return &oauth2.Token{
+				AccessToken:  tok.AccessToken,
+				TokenType:    tok.TokenType,
+				RefreshToken: tok.RefreshToken,
+				Expiry:       time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second),
+			}, nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+			continue
+		default:
+			return nil, fmt.Errorf("device auth failed: %s", tok.Error)
+		}
+	}
+
+	return nil, errors.New("device code expired before it was entered")
+}
+
+func pollDeviceToken(cfg *config.Config, deviceCode string) (*deviceTokenResponse, error) {
+	resp, err := http.PostForm(cfg.TokenURL, urlApi.Values{
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+		"device_code":   {deviceCode},
+		"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tok := &deviceTokenResponse{}
+	err = json.NewDecoder(resp.Body).Decode(tok)
+	return tok, err
+}
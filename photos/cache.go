@@ -0,0 +1,606 @@
+package photos
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jastribl/photosync/files"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	cacheDBFilename = "photosync.db"
+
+	// legacyAllMediaItemsCacheFilename is where media items used to be cached,
+	// it is imported into the cache the first time it is opened
+	legacyAllMediaItemsCacheFilename = "allMediaItems.json"
+)
+
+// Cache is a local store of media items and album membership
+type Cache interface {
+	GetAllMediaItems() ([]*MediaItem, error)
+	GetMediaItem(id string) (*MediaItem, error)
+	GetMediaItemsWithLowercaseFilename(lowercaseFilename string) ([]*MediaItem, error)
+	GetMediaItemsCreatedBetween(start, end time.Time) ([]*MediaItem, error)
+	GetNewestCreationTime() (time.Time, error)
+	PutMediaItems(mediaItems []*MediaItem) error
+	ReplaceAllMediaItems(mediaItems []*MediaItem) error
+
+	GetAllCachedAlbums() ([]*CachedAlbum, error)
+	GetCachedAlbum(albumID string) (*CachedAlbum, error)
+	PutAlbum(album *Album, fetchedAt time.Time) error
+	ReplaceAllAlbums(albums []*Album, fetchedAt time.Time) error
+	GetAlbumIDsForMediaItem(mediaItemID string) ([]string, error)
+	SetAlbumMediaItems(albumID string, mediaItems []*MediaItem, fetchedAt time.Time) error
+
+	GetMediaItemHash(mediaItemID string) (string, error)
+	GetMediaItemsWithHash(hash string) ([]*MediaItem, error)
+	PutMediaItemHash(mediaItemID string, hash string) error
+
+	GetSyncInfo() (*CacheSyncInfo, error)
+	SetSyncInfo(syncInfo *CacheSyncInfo) error
+
+	Close() error
+}
+
+// CacheSyncInfo tracks how the cache was last updated
+type CacheSyncInfo struct {
+	LastFullSync        time.Time `json:"lastFullSync"`
+	LastIncrementalSync time.Time `json:"lastIncrementalSync"`
+	LastAlbumsSync      time.Time `json:"lastAlbumsSync"`
+}
+
+// CachedAlbum is an album along with its ordered media items, if they have
+// been fetched
+type CachedAlbum struct {
+	Album        *Album    `json:"album"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+	MediaItemIDs []string  `json:"mediaItemIds"`
+	// MediaItems are the album's media items as they were fetched, which are
+	// used for the ones that aren't in the media items cache, like shared
+	// album items that aren't in the library
+	MediaItems          []*MediaItem `json:"mediaItems,omitempty"`
+	MediaItemsFetchedAt time.Time    `json:"mediaItemsFetchedAt"`
+}
+
+// HasMediaItems returns if the album's media items have been cached
+func (a *CachedAlbum) HasMediaItems() bool {
+	return !a.MediaItemsFetchedAt.IsZero()
+}
+
+var (
+	mediaItemsBucket           = []byte("mediaItems")
+	mediaItemsByFilenameBucket = []byte("mediaItemsByFilename")
+	mediaItemsByCreationBucket = []byte("mediaItemsByCreationTime")
+	albumsBucket               = []byte("albums")
+	mediaItemAlbumsBucket      = []byte("mediaItemAlbums")
+	syncInfoBucket             = []byte("syncInfo")
+	mediaItemHashesBucket      = []byte("mediaItemHashes")
+	mediaItemsByHashBucket     = []byte("mediaItemsByHash")
+
+	syncInfoKey = []byte("syncInfo")
+
+	// keySeparator separates the parts of an index key, it sorts before any
+	// character that can show up in a filename or time
+	keySeparator = []byte{0}
+)
+
+// creationTimeKeyFormat is a fixed width format so index keys sort by time
+const creationTimeKeyFormat = "2006-01-02T15:04:05.000000000Z"
+
+type boltCache struct {
+	db *bolt.DB
+}
+
+// OpenBoltCache opens (or creates) a Cache backed by a bbolt database file
+func OpenBoltCache(path string) (Cache, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{
+			mediaItemsBucket,
+			mediaItemsByFilenameBucket,
+			mediaItemsByCreationBucket,
+			albumsBucket,
+			mediaItemAlbumsBucket,
+			syncInfoBucket,
+			mediaItemHashesBucket,
+			mediaItemsByHashBucket,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltCache{db: db}, nil
+}
+
+func indexKey(parts ...string) []byte {
+	byteParts := [][]byte{}
+	for _, part := range parts {
+		byteParts = append(byteParts, []byte(part))
+	}
+	return bytes.Join(byteParts, keySeparator)
+}
+
+// lastIndexKeyPart returns the last part of an index key, which is always the
+// ID that the index points to
+func lastIndexKeyPart(key []byte) string {
+	return string(key[bytes.LastIndex(key, keySeparator)+1:])
+}
+
+func creationTimeKey(mediaItem *MediaItem) string {
+	creationTime, err := time.Parse(time.RFC3339, mediaItem.MediaMetadata.CreationTime)
+	if err != nil {
+		// keep items with bad times at the start of the index
+		return ""
+	}
+	return creationTime.UTC().Format(creationTimeKeyFormat)
+}
+
+func getMediaItem(tx *bolt.Tx, id string) (*MediaItem, error) {
+	value := tx.Bucket(mediaItemsBucket).Get([]byte(id))
+	if value == nil {
+		return nil, nil
+	}
+	mediaItem := &MediaItem{}
+	err := json.Unmarshal(value, mediaItem)
+	return mediaItem, err
+}
+
+func putMediaItem(tx *bolt.Tx, mediaItem *MediaItem) error {
+	oldMediaItem, err := getMediaItem(tx, mediaItem.ID)
+	if err != nil {
+		return err
+	}
+	if oldMediaItem != nil {
+		err := tx.Bucket(mediaItemsByFilenameBucket).Delete(
+			indexKey(strings.ToLower(oldMediaItem.Filename), oldMediaItem.ID),
+		)
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(mediaItemsByCreationBucket).Delete(
+			indexKey(creationTimeKey(oldMediaItem), oldMediaItem.ID),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	value, err := json.Marshal(mediaItem)
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(mediaItemsBucket).Put([]byte(mediaItem.ID), value)
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(mediaItemsByFilenameBucket).Put(
+		indexKey(strings.ToLower(mediaItem.Filename), mediaItem.ID),
+		[]byte{},
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(mediaItemsByCreationBucket).Put(
+		indexKey(creationTimeKey(mediaItem), mediaItem.ID),
+		[]byte{},
+	)
+}
+
+// getIndexedMediaItems gets the media items pointed to by all index keys in
+// the bucket between from (inclusive) and to (exclusive)
+func getIndexedMediaItems(tx *bolt.Tx, bucket, from, to []byte) ([]*MediaItem, error) {
+	mediaItems := []*MediaItem{}
+	cursor := tx.Bucket(bucket).Cursor()
+	for key, _ := cursor.Seek(from); key != nil && bytes.Compare(key, to) < 0; key, _ = cursor.Next() {
+		mediaItem, err := getMediaItem(tx, lastIndexKeyPart(key))
+		if err != nil {
+			return nil, err
+		}
+		if mediaItem != nil {
+			mediaItems = append(mediaItems, mediaItem)
+		}
+	}
+	return mediaItems, nil
+}
+
+func (c *boltCache) GetAllMediaItems() ([]*MediaItem, error) {
+	allMediaItems := []*MediaItem{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(mediaItemsBucket).ForEach(func(_, value []byte) error {
+			mediaItem := &MediaItem{}
+			if err := json.Unmarshal(value, mediaItem); err != nil {
+				return err
+			}
+			allMediaItems = append(allMediaItems, mediaItem)
+			return nil
+		})
+	})
+	return allMediaItems, err
+}
+
+func (c *boltCache) GetMediaItem(id string) (*MediaItem, error) {
+	var mediaItem *MediaItem
+	err := c.db.View(func(tx *bolt.Tx) error {
+		var err error
+		mediaItem, err = getMediaItem(tx, id)
+		return err
+	})
+	return mediaItem, err
+}
+
+func (c *boltCache) GetMediaItemsWithLowercaseFilename(lowercaseFilename string) ([]*MediaItem, error) {
+	var mediaItems []*MediaItem
+	err := c.db.View(func(tx *bolt.Tx) error {
+		var err error
+		mediaItems, err = getIndexedMediaItems(
+			tx,
+			mediaItemsByFilenameBucket,
+			indexKey(lowercaseFilename, ""),
+			indexKey(lowercaseFilename+"\x01"),
+		)
+		return err
+	})
+	return mediaItems, err
+}
+
+func (c *boltCache) GetMediaItemsCreatedBetween(start, end time.Time) ([]*MediaItem, error) {
+	var mediaItems []*MediaItem
+	err := c.db.View(func(tx *bolt.Tx) error {
+		var err error
+		mediaItems, err = getIndexedMediaItems(
+			tx,
+			mediaItemsByCreationBucket,
+			[]byte(start.UTC().Format(creationTimeKeyFormat)),
+			[]byte(end.UTC().Format(creationTimeKeyFormat)),
+		)
+		return err
+	})
+	return mediaItems, err
+}
+
+func (c *boltCache) GetNewestCreationTime() (time.Time, error) {
+	newestCreationTime := time.Time{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		key, _ := tx.Bucket(mediaItemsByCreationBucket).Cursor().Last()
+		if key == nil {
+			return nil
+		}
+		creationTimePart := key[:bytes.Index(key, keySeparator)]
+		if len(creationTimePart) == 0 {
+			return nil
+		}
+		var err error
+		newestCreationTime, err = time.Parse(creationTimeKeyFormat, string(creationTimePart))
+		return err
+	})
+	return newestCreationTime, err
+}
+
+func (c *boltCache) PutMediaItems(mediaItems []*MediaItem) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		for _, mediaItem := range mediaItems {
+			if err := putMediaItem(tx, mediaItem); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *boltCache) ReplaceAllMediaItems(mediaItems []*MediaItem) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{
+			mediaItemsBucket,
+			mediaItemsByFilenameBucket,
+			mediaItemsByCreationBucket,
+		} {
+			if err := tx.DeleteBucket(bucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(bucket); err != nil {
+				return err
+			}
+		}
+		for _, mediaItem := range mediaItems {
+			if err := putMediaItem(tx, mediaItem); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func getCachedAlbum(tx *bolt.Tx, albumID string) (*CachedAlbum, error) {
+	value := tx.Bucket(albumsBucket).Get([]byte(albumID))
+	if value == nil {
+		return nil, nil
+	}
+	cachedAlbum := &CachedAlbum{}
+	err := json.Unmarshal(value, cachedAlbum)
+	return cachedAlbum, err
+}
+
+func putCachedAlbum(tx *bolt.Tx, albumID string, cachedAlbum *CachedAlbum) error {
+	value, err := json.Marshal(cachedAlbum)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(albumsBucket).Put([]byte(albumID), value)
+}
+
+func setAlbumMediaItems(tx *bolt.Tx, albumID string, mediaItems []*MediaItem, fetchedAt time.Time) error {
+	cachedAlbum, err := getCachedAlbum(tx, albumID)
+	if err != nil {
+		return err
+	}
+	if cachedAlbum == nil {
+		cachedAlbum = &CachedAlbum{}
+	}
+	for _, mediaItemID := range cachedAlbum.MediaItemIDs {
+		err := tx.Bucket(mediaItemAlbumsBucket).Delete(indexKey(mediaItemID, albumID))
+		if err != nil {
+			return err
+		}
+	}
+
+	cachedAlbum.MediaItemIDs = []string{}
+	cachedAlbum.MediaItems = mediaItems
+	cachedAlbum.MediaItemsFetchedAt = fetchedAt
+	for _, mediaItem := range mediaItems {
+		cachedAlbum.MediaItemIDs = append(cachedAlbum.MediaItemIDs, mediaItem.ID)
+		err := tx.Bucket(mediaItemAlbumsBucket).Put(indexKey(mediaItem.ID, albumID), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	return putCachedAlbum(tx, albumID, cachedAlbum)
+}
+
+func (c *boltCache) GetAllCachedAlbums() ([]*CachedAlbum, error) {
+	cachedAlbums := []*CachedAlbum{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(albumsBucket).ForEach(func(_, value []byte) error {
+			cachedAlbum := &CachedAlbum{}
+			if err := json.Unmarshal(value, cachedAlbum); err != nil {
+				return err
+			}
+			if cachedAlbum.Album != nil {
+				cachedAlbums = append(cachedAlbums, cachedAlbum)
+			}
+			return nil
+		})
+	})
+	return cachedAlbums, err
+}
+
+func (c *boltCache) GetCachedAlbum(albumID string) (*CachedAlbum, error) {
+	var cachedAlbum *CachedAlbum
+	err := c.db.View(func(tx *bolt.Tx) error {
+		var err error
+		cachedAlbum, err = getCachedAlbum(tx, albumID)
+		return err
+	})
+	return cachedAlbum, err
+}
+
+func (c *boltCache) PutAlbum(album *Album, fetchedAt time.Time) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		cachedAlbum, err := getCachedAlbum(tx, album.ID)
+		if err != nil {
+			return err
+		}
+		if cachedAlbum == nil {
+			cachedAlbum = &CachedAlbum{}
+		}
+		cachedAlbum.Album = album
+		cachedAlbum.FetchedAt = fetchedAt
+		return putCachedAlbum(tx, album.ID, cachedAlbum)
+	})
+}
+
+// ReplaceAllAlbums stores the given albums, keeping any cached media item IDs
+// for them, and drops all other albums from the cache
+func (c *boltCache) ReplaceAllAlbums(albums []*Album, fetchedAt time.Time) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		albumIDs := map[string]bool{}
+		for _, album := range albums {
+			albumIDs[album.ID] = true
+			cachedAlbum, err := getCachedAlbum(tx, album.ID)
+			if err != nil {
+				return err
+			}
+			if cachedAlbum == nil {
+				cachedAlbum = &CachedAlbum{}
+			}
+			cachedAlbum.Album = album
+			cachedAlbum.FetchedAt = fetchedAt
+			if err := putCachedAlbum(tx, album.ID, cachedAlbum); err != nil {
+				return err
+			}
+		}
+
+		albumIDsToRemove := []string{}
+		err := tx.Bucket(albumsBucket).ForEach(func(key, _ []byte) error {
+			if !albumIDs[string(key)] {
+				albumIDsToRemove = append(albumIDsToRemove, string(key))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, albumID := range albumIDsToRemove {
+			if err := setAlbumMediaItems(tx, albumID, nil, time.Time{}); err != nil {
+				return err
+			}
+			if err := tx.Bucket(albumsBucket).Delete([]byte(albumID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *boltCache) GetAlbumIDsForMediaItem(mediaItemID string) ([]string, error) {
+	albumIDs := []string{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		prefix := indexKey(mediaItemID, "")
+		cursor := tx.Bucket(mediaItemAlbumsBucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			albumIDs = append(albumIDs, lastIndexKeyPart(key))
+		}
+		return nil
+	})
+	return albumIDs, err
+}
+
+// SetAlbumMediaItems stores the ordered media items of an album, passing no
+// media items and a zero fetchedAt forgets them
+func (c *boltCache) SetAlbumMediaItems(albumID string, mediaItems []*MediaItem, fetchedAt time.Time) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return setAlbumMediaItems(tx, albumID, mediaItems, fetchedAt)
+	})
+}
+
+// GetMediaItemHash gets the content hash of a media item, or an empty string
+// if it hasn't been hashed
+func (c *boltCache) GetMediaItemHash(mediaItemID string) (string, error) {
+	hash := ""
+	err := c.db.View(func(tx *bolt.Tx) error {
+		hash = string(tx.Bucket(mediaItemHashesBucket).Get([]byte(mediaItemID)))
+		return nil
+	})
+	return hash, err
+}
+
+func (c *boltCache) GetMediaItemsWithHash(hash string) ([]*MediaItem, error) {
+	var mediaItems []*MediaItem
+	err := c.db.View(func(tx *bolt.Tx) error {
+		var err error
+		mediaItems, err = getIndexedMediaItems(
+			tx,
+			mediaItemsByHashBucket,
+			indexKey(hash, ""),
+			indexKey(hash+"\x01"),
+		)
+		return err
+	})
+	return mediaItems, err
+}
+
+// PutMediaItemHash stores the content hash of a media item. Hashes are kept
+// when the media items are replaced, as a media item's content never changes.
+func (c *boltCache) PutMediaItemHash(mediaItemID string, hash string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		oldHash := tx.Bucket(mediaItemHashesBucket).Get([]byte(mediaItemID))
+		if oldHash != nil {
+			err := tx.Bucket(mediaItemsByHashBucket).Delete(indexKey(string(oldHash), mediaItemID))
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Bucket(mediaItemHashesBucket).Put([]byte(mediaItemID), []byte(hash))
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(mediaItemsByHashBucket).Put(indexKey(hash, mediaItemID), []byte{})
+	})
+}
+
+func (c *boltCache) GetSyncInfo() (*CacheSyncInfo, error) {
+	syncInfo := &CacheSyncInfo{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(syncInfoBucket).Get(syncInfoKey)
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, syncInfo)
+	})
+	return syncInfo, err
+}
+
+func (c *boltCache) SetSyncInfo(syncInfo *CacheSyncInfo) error {
+	value, err := json.Marshal(syncInfo)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(syncInfoBucket).Put(syncInfoKey, value)
+	})
+}
+
+func (c *boltCache) Close() error {
+	return c.db.Close()
+}
+
+// Cache gets the client's cache, opening it the first time it is needed
+func (m *Client) Cache() (Cache, error) {
+	if m.cache != nil {
+		return m.cache, nil
+	}
+	if err := os.MkdirAll(m.cfg.CacheDir, 0755); err != nil {
+		return nil, err
+	}
+	cache, err := OpenBoltCache(filepath.Join(m.cfg.CacheDir, cacheDBFilename))
+	if err != nil {
+		return nil, err
+	}
+	legacyCacheFile := filepath.Join(m.cfg.CacheDir, legacyAllMediaItemsCacheFilename)
+	if err := importLegacyJSONCache(cache, legacyCacheFile); err != nil {
+		cache.Close()
+		return nil, err
+	}
+	m.cache = cache
+	return cache, nil
+}
+
+// importLegacyJSONCache fills an empty cache from the old JSON cache file so
+// that upgrading doesn't need a full sync
+func importLegacyJSONCache(cache Cache, legacyCacheFile string) error {
+	syncInfo, err := cache.GetSyncInfo()
+	if err != nil {
+		return err
+	}
+	if !syncInfo.LastFullSync.IsZero() || !files.FileExists(legacyCacheFile) {
+		return nil
+	}
+
+	legacyCacheFileInfo, err := os.Stat(legacyCacheFile)
+	if err != nil {
+		return err
+	}
+	bytes, err := ioutil.ReadFile(legacyCacheFile)
+	if err != nil {
+		return err
+	}
+	var allMediaItems []*MediaItem
+	err = json.Unmarshal(bytes, &allMediaItems)
+	if err != nil {
+		return err
+	}
+	log.Printf("Importing %d media items from %s\n", len(allMediaItems), legacyCacheFile)
+	err = cache.ReplaceAllMediaItems(allMediaItems)
+	if err != nil {
+		return err
+	}
+
+	syncInfo.LastFullSync = legacyCacheFileInfo.ModTime()
+	return cache.SetSyncInfo(syncInfo)
+}
@@ -7,9 +7,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	urlApi "net/url"
-	"os"
-	"os/exec"
+	"time"
 
 	"github.com/jastribl/photosync/config"
 	"golang.org/x/oauth2"
@@ -17,91 +15,27 @@ import (
 
 // Client holds all things for Photos requests
 type Client struct {
+	cfg        *config.Config
 	httpClient *http.Client
+	cache      Cache
+	// ctx stops retries when it is done
+	ctx context.Context
+	// albumsRefreshed is set once the albums have been re-fetched by this
+	// client, so looking up missing albums doesn't re-fetch them every time
+	albumsRefreshed bool
 }
 
-// HasToken returns if the user has a token
-func HasToken(cfg *config.Config) bool {
-	_, err := tokenFromFile(cfg)
-	return err == nil
-}
-
-// Retrieves a token from a local file.
-func tokenFromFile(cfg *config.Config) (*oauth2.Token, error) {
-	f, err := os.Open(cfg.TokenFileLocation)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
-}
-
-// SaveToken saves a token given a config
-func SaveToken(cfg *config.Config, token *oauth2.Token) error {
-	f, err := os.OpenFile(cfg.TokenFileLocation, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
-	}
-	defer f.Close()
-	return json.NewEncoder(f).Encode(token)
-}
-
-// GetAuthConfig returns a new auth config
-func GetAuthConfig(cfg *config.Config) *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     cfg.ClientID,
-		ClientSecret: cfg.ClientSecret,
-		Scopes:       cfg.Scopes,
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  cfg.AuthURL,
-			TokenURL: cfg.TokenURL,
-		},
-		RedirectURL: cfg.RedirectURL,
-	}
-}
-
-// NewClientForUser gets a new client for a user using the user token
-func NewClientForUser(cfg *config.Config) (*Client, error) {
-	oauthConfig := GetAuthConfig(cfg)
-
-	url := oauthConfig.AuthCodeURL("state", oauth2.AccessTypeOffline)
-
+// NewClientForUser gets a new client for a user using the user token. Waiting
+// to retry requests stops when the context is done.
+func NewClientForUser(ctx context.Context, cfg *config.Config) (*Client, error) {
 	if !HasToken(cfg) {
-		err := exec.Command("open", url).Start()
+		tok, err := getTokenFromUser(cfg)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-
-		http.HandleFunc("/oauth/callback", func(w http.ResponseWriter, r *http.Request) {
-			queryParts, _ := urlApi.ParseQuery(r.URL.RawQuery)
-
-			// Use the authorization code that is pushed to the redirect
-			// URL.
-			code := queryParts["code"][0]
-
-			// Exchange will do the handshake to retrieve the initial access token.
-			tok, err := oauthConfig.Exchange(context.Background(), code)
-			if err != nil {
-				log.Fatal(err)
-			}
-			SaveToken(cfg, tok)
-
-			// show succes page
-			msg := "<p><strong>Success!</strong></p>"
-			msg = msg + "<p>You are authenticated and can now return to the CLI.</p>"
-			fmt.Fprint(w, msg)
-
-			cfg.TokenDoneSignal <- true
-		})
-		go func() {
-			log.Fatal(http.ListenAndServe("localhost:8080", nil))
-		}()
-
-		done := <-cfg.TokenDoneSignal
-		if !done {
-			log.Fatal("Error in getting token")
+		err = SaveToken(cfg, tok)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -111,7 +45,9 @@ func NewClientForUser(cfg *config.Config) (*Client, error) {
 	}
 
 	return &Client{
-		httpClient: GetAuthConfig(cfg).Client(context.Background(), tok),
+		cfg:        cfg,
+		httpClient: oauth2.NewClient(context.Background(), newPersistingTokenSource(cfg, tok)),
+		ctx:        ctx,
 	}, nil
 }
 
@@ -132,3 +68,54 @@ func (m *Client) postJson(url string, requestBody interface{}, responseObj inter
 
 	return json.NewDecoder(resp.Body).Decode(&responseObj)
 }
+
+// maxQuotaWait is how long retryOnQuotaErrors waits in total for the quota to
+// come back. The per minute quota comes back well within it, but the daily
+// quota doesn't for hours, so there is no point waiting for that.
+const maxQuotaWait = 2 * time.Minute
+
+// retryOnQuotaErrors calls doRequest until it succeeds, backing off whenever the
+// API reports that the quota has been exhausted. It gives up with the quota
+// error after waiting maxQuotaWait, or when the client's context is done.
+func (m *Client) retryOnQuotaErrors(doRequest func() (*ErrorResponse, error)) error {
+	waited := time.Duration(0)
+	for sleepSeconds := 1; ; sleepSeconds *= 2 {
+		if sleepSeconds > 10 {
+			sleepSeconds = 10
+		}
+		errorResponse, err := doRequest()
+		if err != nil {
+			return err
+		}
+		if errorResponse == nil {
+			return nil
+		}
+		if errorResponse.Status != "RESOURCE_EXHAUSTED" {
+			return fmt.Errorf(
+				"got an error other than resource exhausted: %s - %s",
+				errorResponse.Message,
+				errorResponse.Status,
+			)
+		}
+		if waited >= maxQuotaWait {
+			return fmt.Errorf(
+				"API quota still exhausted after waiting %s, try again later: %s - %s",
+				waited,
+				errorResponse.Message,
+				errorResponse.Status,
+			)
+		}
+
+		// this means we need to retry after some time
+		log.Println("Hit API Quota Limit, retrying after a short sleep...")
+		sleep := time.Duration(sleepSeconds) * time.Second
+		timer := time.NewTimer(sleep)
+		select {
+		case <-timer.C:
+		case <-m.ctx.Done():
+			timer.Stop()
+			return m.ctx.Err()
+		}
+		waited += sleep
+	}
+}
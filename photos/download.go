@@ -0,0 +1,141 @@
+package photos
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type mediaItemResponse struct {
+	*MediaItem
+	Error *ErrorResponse `json:"error"`
+}
+
+// GetMediaItem fetches a single media item, which also gets it a new base URL
+// as base URLs expire after an hour
+func (m *Client) GetMediaItem(mediaItemID string) (*MediaItem, error) {
+	d := &mediaItemResponse{}
+	err := m.retryOnQuotaErrors(func() (*ErrorResponse, error) {
+		d = &mediaItemResponse{}
+		resp, err := m.httpClient.Get("https://photoslibrary.googleapis.com/v1/mediaItems/" + mediaItemID)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		err = json.NewDecoder(resp.Body).Decode(d)
+		return d.Error, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d.MediaItem, nil
+}
+
+// downloadURL gets the URL for the original bytes of a media item. Google
+// Photos strips the location from photos downloaded this way, and videos are
+// the processed version, so they aren't always byte for byte the same as the
+// uploaded file.
+func downloadURL(mediaItem *MediaItem) string {
+	if mediaItem.MediaMetadata.Video != nil {
+		return mediaItem.BaseURL + "=dv"
+	}
+	return mediaItem.BaseURL + "=d"
+}
+
+// DownloadMediaItem opens the bytes of a media item, which the caller must
+// close. The media item is fetched again first to get a fresh base URL.
+func (m *Client) DownloadMediaItem(mediaItem *MediaItem) (io.ReadCloser, error) {
+	body, _, err := m.DownloadMediaItemFrom(context.Background(), mediaItem, 0)
+	return body, err
+}
+
+// DownloadMediaItemFrom opens the bytes of a media item starting at the
+// offset, which the caller must close. If the server doesn't support starting
+// part way through, resumed is false and the bytes start from the beginning.
+// The download stops when the context is done.
+func (m *Client) DownloadMediaItemFrom(
+	ctx context.Context,
+	mediaItem *MediaItem,
+	offset int64,
+) (body io.ReadCloser, resumed bool, err error) {
+	freshMediaItem, err := m.GetMediaItem(mediaItem.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL(freshMediaItem), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return resp.Body, false, nil
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		return resp.Body, true, nil
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// there is nothing after the offset, so it was already all downloaded
+		resp.Body.Close()
+		return io.NopCloser(strings.NewReader("")), true, nil
+	}
+	resp.Body.Close()
+	return nil, false, fmt.Errorf("error downloading '%s': %s", mediaItem.Filename, resp.Status)
+}
+
+// GetMediaItemHashWithCache gets the hex SHA-256 hash of a media item's bytes,
+// downloading it only if it hasn't been hashed before
+func (m *Client) GetMediaItemHashWithCache(mediaItem *MediaItem) (string, error) {
+	cache, err := m.Cache()
+	if err != nil {
+		return "", err
+	}
+	hash, err := cache.GetMediaItemHash(mediaItem.ID)
+	if err != nil || hash != "" {
+		return hash, err
+	}
+
+	log.Printf("Downloading '%s' to hash it\n", mediaItem.Filename)
+	body, err := m.DownloadMediaItem(mediaItem)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, body); err != nil {
+		return "", err
+	}
+	hash = hex.EncodeToString(hasher.Sum(nil))
+
+	return hash, cache.PutMediaItemHash(mediaItem.ID, hash)
+}
+
+// PutMediaItemHash caches the hash of a media item's bytes, for when they were
+// downloaded for something else
+func (m *Client) PutMediaItemHash(mediaItemID string, hash string) error {
+	cache, err := m.Cache()
+	if err != nil {
+		return err
+	}
+	return cache.PutMediaItemHash(mediaItemID, hash)
+}
+
+// GetMediaItemsWithHashWithCache gets the cached media items that have been
+// hashed to the given hash
+func (m *Client) GetMediaItemsWithHashWithCache(hash string) ([]*MediaItem, error) {
+	cache, err := m.ensureMediaItemsCached()
+	if err != nil {
+		return nil, err
+	}
+	return cache.GetMediaItemsWithHash(hash)
+}
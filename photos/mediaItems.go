@@ -4,17 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"os"
 	"strings"
-
-	"github.com/jastribl/photosync/files"
+	"time"
 )
 
-const allMediaItemsCacheFile = "cache/allMediaItems.json"
-
 func (m *Client) CacheAndReturnAllMediaItems() ([]*MediaItem, error) {
+	cache, err := m.Cache()
+	if err != nil {
+		return nil, err
+	}
+
+	syncStartTime := time.Now()
 	var allMediaItems []*MediaItem
 	for lastPageToken, dedupMap := "", map[string]bool{}; ; {
 		mediaItems, err := m.getMediaItems(lastPageToken)
@@ -33,49 +34,129 @@ func (m *Client) CacheAndReturnAllMediaItems() ([]*MediaItem, error) {
 		}
 	}
 
-	bytes, _ := json.MarshalIndent(allMediaItems, "", " ")
+	err = cache.ReplaceAllMediaItems(allMediaItems)
+	if err != nil {
+		return nil, err
+	}
 
-	file, err := os.Create(allMediaItemsCacheFile)
+	syncInfo, err := cache.GetSyncInfo()
 	if err != nil {
 		return nil, err
 	}
-	file.Close()
-	err = ioutil.WriteFile(allMediaItemsCacheFile, bytes, 0644)
+	syncInfo.LastFullSync = syncStartTime
+	err = cache.SetSyncInfo(syncInfo)
 
 	return allMediaItems, err
 }
 
-func (m *Client) GetAllMediaItemsWithCache() ([]*MediaItem, error) {
-	if !files.FileExists(allMediaItemsCacheFile) {
-		allMediaItems, err := m.CacheAndReturnAllMediaItems()
+// RefreshMediaItemsCache brings the media items cache up to date. Only media
+// items created on or after the day of the newest cached media item are
+// fetched, unless there is no cache yet or the last full sync is older than
+// fullSyncInterval, in which case everything is re-fetched so that deleted
+// media items drop out of the cache.
+func (m *Client) RefreshMediaItemsCache(fullSyncInterval time.Duration) ([]*MediaItem, error) {
+	cache, err := m.Cache()
+	if err != nil {
+		return nil, err
+	}
+	syncInfo, err := cache.GetSyncInfo()
+	if err != nil {
+		return nil, err
+	}
+	if syncInfo.LastFullSync.IsZero() {
+		log.Println("No media items cache found, doing a full sync")
+		return m.CacheAndReturnAllMediaItems()
+	}
+	if time.Since(syncInfo.LastFullSync) > fullSyncInterval {
+		log.Printf("Last full sync was at %s, doing a full sync\n", syncInfo.LastFullSync.Format(time.RFC3339))
+		return m.CacheAndReturnAllMediaItems()
+	}
+
+	syncStartTime := time.Now()
+	newestCreationTime, err := cache.GetNewestCreationTime()
+	if err != nil {
+		return nil, err
+	}
+	// the date filter works in whole days and the creation time is in UTC, so
+	// give both ends a day of slack to be safe around timezones
+	startDate := newestCreationTime.AddDate(0, 0, -1)
+	endDate := syncStartTime.AddDate(0, 0, 1)
+	log.Printf(
+		"Fetching media items created between %s and %s\n",
+		startDate.Format("2006-01-02"),
+		endDate.Format("2006-01-02"),
+	)
+
+	numNew := 0
+	for lastPageToken := ""; ; {
+		mediaItems, err := m.searchMediaItemsCreatedBetween(startDate, endDate, lastPageToken)
 		if err != nil {
 			return nil, err
 		}
-		return allMediaItems, nil
+		for _, mediaItem := range mediaItems.MediaItems {
+			cachedMediaItem, err := cache.GetMediaItem(mediaItem.ID)
+			if err != nil {
+				return nil, err
+			}
+			if cachedMediaItem == nil {
+				numNew += 1
+			}
+		}
+		err = cache.PutMediaItems(mediaItems.MediaItems)
+		if err != nil {
+			return nil, err
+		}
+		lastPageToken = mediaItems.NextPageToken
+		if lastPageToken == "" {
+			break
+		}
 	}
+	log.Printf("Found %d new media items\n", numNew)
 
-	var allMediaItems []*MediaItem
-
-	bytes, err := ioutil.ReadFile(allMediaItemsCacheFile)
+	syncInfo.LastIncrementalSync = syncStartTime
+	err = cache.SetSyncInfo(syncInfo)
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal([]byte(bytes), &allMediaItems)
+	return cache.GetAllMediaItems()
+}
+
+// ensureMediaItemsCached does a full sync of the media items cache if it has
+// never been filled
+func (m *Client) ensureMediaItemsCached() (Cache, error) {
+	cache, err := m.Cache()
 	if err != nil {
 		return nil, err
 	}
-
-	return allMediaItems, err
+	syncInfo, err := cache.GetSyncInfo()
+	if err != nil {
+		return nil, err
+	}
+	if syncInfo.LastFullSync.IsZero() {
+		if _, err := m.CacheAndReturnAllMediaItems(); err != nil {
+			return nil, err
+		}
+	}
+	return cache, nil
 }
 
-func (m *Client) GetAllLowercaseFilenameToMediaItemMapWithCache() (map[string][]*MediaItem, error) {
-	allMediaItems, err := m.GetAllMediaItemsWithCache()
+func (m *Client) GetAllMediaItemsWithCache() ([]*MediaItem, error) {
+	cache, err := m.ensureMediaItemsCached()
 	if err != nil {
 		return nil, err
 	}
+	return cache.GetAllMediaItems()
+}
 
-	return MediaItemsToLowercaseFilenameMap(allMediaItems), nil
+// GetMediaItemsWithLowercaseFilenameWithCache looks up all library media items
+// with the given lowercase filename in the cache
+func (m *Client) GetMediaItemsWithLowercaseFilenameWithCache(lowercaseFilename string) ([]*MediaItem, error) {
+	cache, err := m.ensureMediaItemsCached()
+	if err != nil {
+		return nil, err
+	}
+	return cache.GetMediaItemsWithLowercaseFilename(lowercaseFilename)
 }
 
 func (m *Client) GetAllMediaItemsForAlbum(album *Album) ([]*MediaItem, error) {
@@ -96,6 +177,63 @@ func (m *Client) GetAllMediaItemsForAlbum(album *Album) ([]*MediaItem, error) {
 	return allMediaItems, nil
 }
 
+func (m *Client) cacheAndReturnAllMediaItemsForAlbum(album *Album) ([]*MediaItem, error) {
+	cache, err := m.Cache()
+	if err != nil {
+		return nil, err
+	}
+
+	fetchedAt := time.Now()
+	albumMediaItems, err := m.GetAllMediaItemsForAlbum(album)
+	if err != nil {
+		return nil, err
+	}
+	err = cache.SetAlbumMediaItems(album.ID, albumMediaItems, fetchedAt)
+
+	return albumMediaItems, err
+}
+
+// GetAllMediaItemsForAlbumWithCache gets the media items of an album, in album
+// order, from the cache. They are fetched if the album's media items have never
+// been cached. The media items cache is used for the media items in it, since
+// it is kept more up to date, and the copies cached with the album for the rest.
+func (m *Client) GetAllMediaItemsForAlbumWithCache(album *Album) ([]*MediaItem, error) {
+	cache, err := m.Cache()
+	if err != nil {
+		return nil, err
+	}
+	cachedAlbum, err := cache.GetCachedAlbum(album.ID)
+	if err != nil {
+		return nil, err
+	}
+	if cachedAlbum == nil || !cachedAlbum.HasMediaItems() {
+		return m.cacheAndReturnAllMediaItemsForAlbum(album)
+	}
+
+	albumCopies := map[string]*MediaItem{}
+	for _, mediaItem := range cachedAlbum.MediaItems {
+		albumCopies[mediaItem.ID] = mediaItem
+	}
+	albumMediaItems := []*MediaItem{}
+	for _, mediaItemID := range cachedAlbum.MediaItemIDs {
+		mediaItem, err := cache.GetMediaItem(mediaItemID)
+		if err != nil {
+			return nil, err
+		}
+		if mediaItem == nil {
+			mediaItem = albumCopies[mediaItemID]
+		}
+		if mediaItem == nil {
+			// only albums cached before their media items were kept with them
+			log.Printf("Album '%s' has media items that aren't cached, fetching them\n", album.Title)
+			return m.cacheAndReturnAllMediaItemsForAlbum(album)
+		}
+		albumMediaItems = append(albumMediaItems, mediaItem)
+	}
+
+	return albumMediaItems, nil
+}
+
 func (m *Client) getMediaItems(pageToken string) (*MediaItems, error) {
 	otherParams := ""
 	if pageToken != "" {
@@ -123,18 +261,64 @@ func (m *Client) getMediaItems(pageToken string) (*MediaItems, error) {
 	return d, err
 }
 
+type Date struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day"`
+}
+
+func NewDate(t time.Time) *Date {
+	return &Date{
+		Year:  t.Year(),
+		Month: int(t.Month()),
+		Day:   t.Day(),
+	}
+}
+
+type DateRange struct {
+	StartDate *Date `json:"startDate"`
+	EndDate   *Date `json:"endDate"`
+}
+
+type DateFilter struct {
+	Ranges []*DateRange `json:"ranges"`
+}
+
+type Filters struct {
+	DateFilter *DateFilter `json:"dateFilter,omitempty"`
+}
+
 type SearchRequest struct {
-	PageSize  int    `json:"pageSize"`
-	PageToken string `json:"pageToken"`
-	AlbumId   string `json:"albumId"`
+	PageSize  int      `json:"pageSize"`
+	PageToken string   `json:"pageToken"`
+	AlbumId   string   `json:"albumId,omitempty"`
+	Filters   *Filters `json:"filters,omitempty"`
 }
 
 func (m *Client) searchMediaItems(albumID, pageToken string) (*MediaItems, error) {
-	searchRequest := SearchRequest{
+	return m.doSearchMediaItems(SearchRequest{
 		PageSize:  100,
 		PageToken: pageToken,
 		AlbumId:   albumID,
-	}
+	})
+}
+
+func (m *Client) searchMediaItemsCreatedBetween(startDate, endDate time.Time, pageToken string) (*MediaItems, error) {
+	return m.doSearchMediaItems(SearchRequest{
+		PageSize:  100,
+		PageToken: pageToken,
+		Filters: &Filters{
+			DateFilter: &DateFilter{
+				Ranges: []*DateRange{{
+					StartDate: NewDate(startDate),
+					EndDate:   NewDate(endDate),
+				}},
+			},
+		},
+	})
+}
+
+func (m *Client) doSearchMediaItems(searchRequest SearchRequest) (*MediaItems, error) {
 	jsonStr, err := json.Marshal(searchRequest)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,163 @@
+package photos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxBatchCreateSize is the most new media items that mediaItems:batchCreate
+// accepts in a single request
+const maxBatchCreateSize = 50
+
+// UploadFile uploads the bytes of a local file and returns the upload token
+// that can then be turned into a media item with BatchCreateMediaItems
+func (m *Client) UploadFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequest(
+		"POST",
+		"https://photoslibrary.googleapis.com/v1/uploads",
+		file,
+	)
+	if err != nil {
+		return "", err
+	}
+	request.ContentLength = fileInfo.Size()
+	request.Header.Set("Content-type", "application/octet-stream")
+	request.Header.Set("X-Goog-Upload-File-Name", filepath.Base(filePath))
+	request.Header.Set("X-Goog-Upload-Protocol", "raw")
+	if mimeType := mime.TypeByExtension(filepath.Ext(filePath)); mimeType != "" {
+		request.Header.Set("X-Goog-Upload-Content-Type", mimeType)
+	}
+
+	resp, err := m.httpClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(
+			"error uploading '%s': %s - %s",
+			filePath,
+			resp.Status,
+			strings.TrimSpace(string(body)),
+		)
+	}
+
+	return string(body), nil
+}
+
+type SimpleMediaItem struct {
+	UploadToken string `json:"uploadToken"`
+	FileName    string `json:"fileName,omitempty"`
+}
+
+type NewMediaItem struct {
+	Description     string           `json:"description,omitempty"`
+	SimpleMediaItem *SimpleMediaItem `json:"simpleMediaItem"`
+}
+
+type BatchCreateRequest struct {
+	AlbumID       string          `json:"albumId,omitempty"`
+	NewMediaItems []*NewMediaItem `json:"newMediaItems"`
+}
+
+type Status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type NewMediaItemResult struct {
+	UploadToken string     `json:"uploadToken"`
+	Status      *Status    `json:"status"`
+	MediaItem   *MediaItem `json:"mediaItem"`
+}
+
+// Succeeded returns if the media item was created
+func (r *NewMediaItemResult) Succeeded() bool {
+	return (r.Status == nil || r.Status.Code == 0) && r.MediaItem != nil
+}
+
+type BatchCreateResponse struct {
+	NewMediaItemResults []*NewMediaItemResult `json:"newMediaItemResults"`
+	Error               *ErrorResponse        `json:"error"`
+}
+
+// BatchCreateMediaItems turns upload tokens into media items, adding them to
+// the given album if albumID is not empty. The result for every new media item
+// is returned so the caller can check the status of each one. The created
+// media items are added to the media items cache.
+func (m *Client) BatchCreateMediaItems(
+	albumID string,
+	newMediaItems []*NewMediaItem,
+) ([]*NewMediaItemResult, error) {
+	cache, err := m.Cache()
+	if err != nil {
+		return nil, err
+	}
+	if albumID != "" {
+		if err := m.forgetCachedAlbumMediaItems(albumID); err != nil {
+			return nil, err
+		}
+	}
+
+	var allResults []*NewMediaItemResult
+	for start := 0; start < len(newMediaItems); start += maxBatchCreateSize {
+		end := start + maxBatchCreateSize
+		if end > len(newMediaItems) {
+			end = len(newMediaItems)
+		}
+
+		request := BatchCreateRequest{
+			AlbumID:       albumID,
+			NewMediaItems: newMediaItems[start:end],
+		}
+		var response *BatchCreateResponse
+		err := m.retryOnQuotaErrors(func() (*ErrorResponse, error) {
+			response = &BatchCreateResponse{}
+			err := m.postJson(
+				"https://photoslibrary.googleapis.com/v1/mediaItems:batchCreate",
+				request,
+				response,
+			)
+			return response.Error, err
+		})
+		if err != nil {
+			return allResults, err
+		}
+		log.Printf("Created batch of %d media items\n", end-start)
+		allResults = append(allResults, response.NewMediaItemResults...)
+
+		created := []*MediaItem{}
+		for _, result := range response.NewMediaItemResults {
+			if result.Succeeded() {
+				created = append(created, result.MediaItem)
+			}
+		}
+		if err := cache.PutMediaItems(created); err != nil {
+			return allResults, err
+		}
+	}
+
+	return allResults, nil
+}
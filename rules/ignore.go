@@ -0,0 +1,202 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFilename is the name of the files with gitignore style patterns that
+// apply to the folder they are in and everything under it
+const IgnoreFilename = ".photosyncignore"
+
+// ignorePattern is a single line of an ignore file
+type ignorePattern struct {
+	line    string
+	lineNum int
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreFile is a parsed ignore file
+type IgnoreFile struct {
+	// dir is the path of the folder the file is in, relative to the root dir
+	dir      string
+	patterns []*ignorePattern
+}
+
+// LoadIgnoreFile loads the ignore file of the dir at relDir under rootDir,
+// returning nil if it doesn't have one
+func LoadIgnoreFile(rootDir, relDir string) (*IgnoreFile, error) {
+	f, err := os.Open(filepath.Join(rootDir, relDir, IgnoreFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseIgnoreFile(relDir, f)
+}
+
+// ParseIgnoreFile parses the ignore file of the dir at relDir
+func ParseIgnoreFile(relDir string, r io.Reader) (*IgnoreFile, error) {
+	ignoreFile := &IgnoreFile{dir: strings.Trim(filepath.ToSlash(relDir), "/")}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum += 1
+		p, err := compileIgnorePattern(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %s", ignoreFile.path(), lineNum, err.Error())
+		}
+		if p == nil {
+			continue
+		}
+		p.lineNum = lineNum
+		ignoreFile.patterns = append(ignoreFile.patterns, p)
+	}
+	return ignoreFile, scanner.Err()
+}
+
+func (f *IgnoreFile) path() string {
+	return path.Join(f.dir, IgnoreFilename)
+}
+
+// compileIgnorePattern compiles a line of an ignore file, returning nil for
+// blank lines and comments
+func compileIgnorePattern(line string) (*ignorePattern, error) {
+	p := &ignorePattern{line: line}
+
+	// trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// a pattern with a slash anywhere but the end is relative to the ignore
+	// file's dir, otherwise it matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return nil, fmt.Errorf("empty pattern '%s'", p.line)
+	}
+
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case strings.HasPrefix(line[i:], "**/") && (i == 0 || line[i-1] == '/'):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "**") && i == len(line)-2 && (i == 0 || line[i-1] == '/'):
+			expr.WriteString(".*")
+			i += 1
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '\\' && i+1 < len(line):
+			i += 1
+			expr.WriteString(regexp.QuoteMeta(line[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(line[i+1:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed '[' in '%s'", p.line)
+			}
+			class := line[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, "\\", "\\\\") + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(line[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+
+	regex, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("bad pattern '%s': %s", p.line, err.Error())
+	}
+	p.regex = regex
+	return p, nil
+}
+
+// match returns the last pattern in the file matching the path, relative to
+// the root dir, or nil if none do or the path isn't under the file's dir
+func (f *IgnoreFile) match(relPath string, isDir bool) *ignorePattern {
+	if f.dir != "" {
+		if !strings.HasPrefix(relPath, f.dir+"/") {
+			return nil
+		}
+		relPath = relPath[len(f.dir)+1:]
+	}
+	for i := len(f.patterns) - 1; i >= 0; i-- {
+		p := f.patterns[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.regex.MatchString(relPath) {
+			return p
+		}
+	}
+	return nil
+}
+
+// IgnoreFiles are the ignore files that apply to a dir, from the root dir down
+type IgnoreFiles []*IgnoreFile
+
+// With returns the ignore files with another, deeper, one added
+func (files IgnoreFiles) With(ignoreFile *IgnoreFile) IgnoreFiles {
+	if ignoreFile == nil {
+		return files
+	}
+	withFile := make(IgnoreFiles, len(files), len(files)+1)
+	copy(withFile, files)
+	return append(withFile, ignoreFile)
+}
+
+// ShouldSkip returns if the path, relative to the root dir, is ignored
+func (files IgnoreFiles) ShouldSkip(relPath string, isDir bool) bool {
+	return files.Explain(relPath, isDir).Skip
+}
+
+// Explain decides if the path, relative to the root dir, is ignored and says
+// which pattern decided it. Like gitignore, deeper files take precedence and
+// the last matching pattern in a file wins.
+func (files IgnoreFiles) Explain(relPath string, isDir bool) *Decision {
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+	for i := len(files) - 1; i >= 0; i-- {
+		p := files[i].match(relPath, isDir)
+		if p == nil {
+			continue
+		}
+		location := fmt.Sprintf("'%s' (%s line %d)", p.line, files[i].path(), p.lineNum)
+		if p.negate {
+			return &Decision{Reason: "re-included by " + location}
+		}
+		return &Decision{Skip: true, Reason: "ignored by " + location}
+	}
+	return &Decision{Reason: "no " + IgnoreFilename + " pattern matches"}
+}
@@ -0,0 +1,231 @@
+package rules
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jastribl/photosync/config"
+)
+
+const (
+	// MatchBasename matches a pattern against a folder's name
+	MatchBasename = "basename"
+	// MatchPath matches a pattern against a folder's path relative to the root
+	// dir, using forward slashes
+	MatchPath = "path"
+)
+
+// Decision is whether a path gets skipped and why
+type Decision struct {
+	Skip   bool
+	Reason string
+}
+
+// pattern is a compiled config.FolderPattern
+type pattern struct {
+	// ruleSet is the name of the rule set the pattern is from
+	ruleSet   string
+	glob      string
+	regex     *regexp.Regexp
+	matchPath bool
+}
+
+func compilePattern(ruleSet string, folderPattern *config.FolderPattern) (*pattern, error) {
+	p := &pattern{ruleSet: ruleSet}
+	switch folderPattern.Match {
+	case "", MatchBasename:
+	case MatchPath:
+		p.matchPath = true
+	default:
+		return nil, fmt.Errorf("unknown match '%s', must be one of: %s, %s", folderPattern.Match, MatchBasename, MatchPath)
+	}
+
+	switch {
+	case folderPattern.Glob != "" && folderPattern.Regex != "":
+		return nil, fmt.Errorf("pattern has both a glob '%s' and a regex '%s'", folderPattern.Glob, folderPattern.Regex)
+	case folderPattern.Glob != "":
+		// check the glob is valid now rather than on every match
+		if _, err := path.Match(folderPattern.Glob, ""); err != nil {
+			return nil, fmt.Errorf("bad glob '%s': %s", folderPattern.Glob, err.Error())
+		}
+		p.glob = folderPattern.Glob
+	case folderPattern.Regex != "":
+		regex, err := regexp.Compile(folderPattern.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("bad regex '%s': %s", folderPattern.Regex, err.Error())
+		}
+		p.regex = regex
+	default:
+		return nil, fmt.Errorf("pattern has neither a glob nor a regex")
+	}
+	return p, nil
+}
+
+func (p *pattern) matches(relPath string) bool {
+	s := relPath
+	if !p.matchPath {
+		s = path.Base(relPath)
+	}
+	if p.regex != nil {
+		return p.regex.MatchString(s)
+	}
+	matched, _ := path.Match(p.glob, s)
+	return matched
+}
+
+func (p *pattern) String() string {
+	description := fmt.Sprintf("glob '%s'", p.glob)
+	if p.regex != nil {
+		description = fmt.Sprintf("regex '%s'", p.regex.String())
+	}
+	if p.matchPath {
+		description += " on the path"
+	}
+	if p.ruleSet != "" {
+		description += fmt.Sprintf(" in folder rule set '%s'", p.ruleSet)
+	}
+	return description
+}
+
+// FolderRules decides which folders get skipped when walking a dir. A nil
+// FolderRules skips nothing.
+type FolderRules struct {
+	deny  []*pattern
+	allow []*pattern
+}
+
+// Compile compiles rule sets into a single FolderRules
+func Compile(ruleSets ...*config.FolderRuleSet) (*FolderRules, error) {
+	folderRules := &FolderRules{}
+	for _, ruleSet := range ruleSets {
+		if err := folderRules.add("", ruleSet); err != nil {
+			return nil, err
+		}
+	}
+	return folderRules, nil
+}
+
+func (r *FolderRules) add(ruleSetName string, ruleSet *config.FolderRuleSet) error {
+	for _, folderPattern := range ruleSet.Deny {
+		p, err := compilePattern(ruleSetName, folderPattern)
+		if err != nil {
+			return err
+		}
+		r.deny = append(r.deny, p)
+	}
+	for _, folderPattern := range ruleSet.Allow {
+		p, err := compilePattern(ruleSetName, folderPattern)
+		if err != nil {
+			return err
+		}
+		r.allow = append(r.allow, p)
+	}
+	return nil
+}
+
+// ForCommand gets the folder rules the config has for the given command. The
+// picture-path-substrings-to-ignore setting is added as deny regexes to the
+// default rules.
+func ForCommand(cfg *config.Config, commandName string) (*FolderRules, error) {
+	folderRules := &FolderRules{}
+	ruleSetNames, found := cfg.FolderRules[commandName]
+	if !found {
+		ruleSetNames = cfg.FolderRules[config.DefaultFolderRules]
+		legacyRuleSet := &config.FolderRuleSet{}
+		for _, regexToIgnore := range cfg.PicturePathSubstringsToIgnore {
+			legacyRuleSet.Deny = append(legacyRuleSet.Deny, &config.FolderPattern{Regex: regexToIgnore})
+		}
+		if err := folderRules.add("picture-path-substrings-to-ignore", legacyRuleSet); err != nil {
+			return nil, fmt.Errorf("error in picture-path-substrings-to-ignore: %s", err.Error())
+		}
+	}
+	for _, ruleSetName := range ruleSetNames {
+		ruleSet, found := cfg.FolderRuleSets[ruleSetName]
+		if !found {
+			return nil, fmt.Errorf("folder rule set '%s' not found", ruleSetName)
+		}
+		if err := folderRules.add(ruleSetName, ruleSet); err != nil {
+			return nil, fmt.Errorf("error in folder rule set '%s': %s", ruleSetName, err.Error())
+		}
+	}
+	return folderRules, nil
+}
+
+// ShouldSkipDir returns if the dir at the given path, relative to the walked
+// dir, should be skipped
+func (r *FolderRules) ShouldSkipDir(relPath string) bool {
+	return r.ExplainDir(relPath).Skip
+}
+
+// ExplainDir decides if the dir at the given path, relative to the walked dir,
+// should be skipped and says which rule decided it
+func (r *FolderRules) ExplainDir(relPath string) *Decision {
+	if r == nil {
+		return &Decision{Reason: "no folder rules"}
+	}
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+	for _, denyPattern := range r.deny {
+		if denyPattern.matches(relPath) {
+			for _, allowPattern := range r.allow {
+				if allowPattern.matches(relPath) {
+					return &Decision{Reason: fmt.Sprintf("denied by %s but allowed by %s", denyPattern, allowPattern)}
+				}
+			}
+			return &Decision{Skip: true, Reason: fmt.Sprintf("denied by %s", denyPattern)}
+		}
+	}
+	return &Decision{Reason: "no folder rule matches"}
+}
+
+// Decide decides if the file or dir at the given path, relative to the walked
+// dir, gets skipped by the folder rules or the ignore files that apply to it
+func Decide(folderRules *FolderRules, ignoreFiles IgnoreFiles, relPath string, isDir bool) *Decision {
+	ignoreDecision := ignoreFiles.Explain(relPath, isDir)
+	if !isDir {
+		return ignoreDecision
+	}
+	folderDecision := folderRules.ExplainDir(relPath)
+	if folderDecision.Skip {
+		return folderDecision
+	}
+	if ignoreDecision.Skip {
+		return ignoreDecision
+	}
+	return &Decision{Reason: folderDecision.Reason + ", " + ignoreDecision.Reason}
+}
+
+// ExplainPath decides if the file or dir at relPath would be skipped when
+// walking rootDir, checking every folder on the way to it as well
+func ExplainPath(rootDir, relPath string, isDir bool, folderRules *FolderRules) (*Decision, error) {
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+	if relPath == "" || relPath == "." {
+		return &Decision{Reason: "the root dir is always walked"}, nil
+	}
+
+	parts := strings.Split(relPath, "/")
+	ignoreFiles := IgnoreFiles{}
+	dir := ""
+	for i, part := range parts {
+		ignoreFile, err := LoadIgnoreFile(rootDir, dir)
+		if err != nil {
+			return nil, err
+		}
+		ignoreFiles = ignoreFiles.With(ignoreFile)
+
+		current := path.Join(dir, part)
+		isLast := i == len(parts)-1
+		decision := Decide(folderRules, ignoreFiles, current, !isLast || isDir)
+		if isLast {
+			return decision, nil
+		}
+		if decision.Skip {
+			decision.Reason = fmt.Sprintf("in skipped folder '%s', %s", current, decision.Reason)
+			return decision, nil
+		}
+		dir = current
+	}
+	return nil, nil
+}